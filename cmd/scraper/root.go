@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/dmage/triage/pkg/cmd/cleanup"
+	"github.com/dmage/triage/pkg/cmd/cluster"
+	"github.com/dmage/triage/pkg/cmd/discoverprow"
 	"github.com/dmage/triage/pkg/cmd/discovertestgrid"
 	"github.com/dmage/triage/pkg/cmd/exporttriage"
+	"github.com/dmage/triage/pkg/cmd/owners"
+	"github.com/dmage/triage/pkg/cmd/run"
 	"github.com/dmage/triage/pkg/cmd/serve"
+	"github.com/dmage/triage/pkg/cmd/slowtests"
+	"github.com/dmage/triage/pkg/cmd/testnames"
+	"github.com/dmage/triage/pkg/cmd/watch"
 	"github.com/spf13/cobra"
 )
 
@@ -20,13 +30,25 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(discovertestgrid.NewCmdDiscoverTestGrid())
+	rootCmd.AddCommand(discoverprow.NewCmdDiscoverProw())
 	rootCmd.AddCommand(exporttriage.NewCmdExportTriage())
 	rootCmd.AddCommand(serve.NewCmdServe())
 	rootCmd.AddCommand(cleanup.NewCmdCleanup())
+	rootCmd.AddCommand(watch.NewCmdWatch())
+	rootCmd.AddCommand(run.NewCmdRun())
+	rootCmd.AddCommand(cluster.NewCmdCluster())
+	rootCmd.AddCommand(owners.NewCmdOwners())
+	rootCmd.AddCommand(testnames.NewCmdTestNames())
+	rootCmd.AddCommand(slowtests.NewCmdSlowTests())
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Commands stop their work and don't publish partial results when the
+	// context is canceled.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -12,6 +12,7 @@ require (
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/pflag v1.0.5
 	google.golang.org/api v0.40.0
+	k8s.io/apimachinery v0.20.2
 	k8s.io/klog/v2 v2.5.0
 	k8s.io/test-infra v0.0.0-20210217200222-6eb3a5d4016f
 	sigs.k8s.io/yaml v1.2.0
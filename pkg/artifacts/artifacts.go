@@ -5,22 +5,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
-	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
 	"github.com/dmage/triage/pkg/types"
-	"google.golang.org/api/iterator"
 	"k8s.io/klog/v2"
 )
 
 var junitObject = regexp.MustCompile(`/junit.*\.xml$`)
 
+// ErrNotFound is returned by stores when the requested object does not exist.
+var ErrNotFound = errors.New("object not found")
+
 func IsNotFound(err error) bool {
-	return errors.Is(err, storage.ErrObjectNotExist)
+	return errors.Is(err, ErrNotFound)
 }
 
 type InvalidJSONError struct {
@@ -42,7 +44,27 @@ func (e InvalidJSONError) Unwrap() error {
 }
 
 type StartedJson struct {
-	Timestamp int64 `json:"timestamp"`
+	Timestamp   int64                  `json:"timestamp"`
+	Node        string                 `json:"node,omitempty"`
+	Pull        string                 `json:"pull,omitempty"`
+	Repos       map[string]string      `json:"repos,omitempty"`
+	RepoVersion string                 `json:"repo-version,omitempty"`
+	RepoCommit  string                 `json:"repo-commit,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ProwJobJson is the subset of prowjob.json that describes what was tested.
+type ProwJobJson struct {
+	Spec struct {
+		Type      string       `json:"type"`
+		Job       string       `json:"job"`
+		Refs      *types.Refs  `json:"refs,omitempty"`
+		ExtraRefs []types.Refs `json:"extra_refs,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		URL     string `json:"url,omitempty"`
+		BuildID string `json:"build_id,omitempty"`
+	} `json:"status"`
 }
 
 type FinishedJson struct {
@@ -64,113 +86,270 @@ type TestResult struct {
 	Status  TestStatus
 	Output  string
 	Summary string
+
+	// Suite is the name of the junit testsuite that contains the test, and
+	// ClassName is the classname attribute of the testcase.
+	Suite     string `json:",omitempty"`
+	ClassName string `json:",omitempty"`
+
+	// File is the name of the junit file relative to the build directory.
+	File string `json:",omitempty"`
+
+	// Properties are the properties of the testcase.
+	Properties map[string]string `json:",omitempty"`
+
+	// Labels, FailureLocation and StackTrace are set for results from
+	// Ginkgo reports. FailureLocation is the file:line of the failure.
+	Labels          []string `json:",omitempty"`
+	FailureLocation string   `json:",omitempty"`
+	StackTrace      string   `json:",omitempty"`
+
+	// Synthetic is set for results that are not reported by tests, like
+	// failures of builds that don't have test results.
+	Synthetic bool `json:",omitempty"`
+
+	// Duration is the duration of the test in seconds from the junit time
+	// attribute. It is zero if it is unknown.
+	Duration float64 `json:",omitempty"`
 }
 
-type Client struct {
-	gcsClient *storage.Client
+// TestKey identifies a test in a build. Tests with the same name may be run
+// by several suites of one build, for example in the upgrade and conformance
+// phases of a job. Junit files are not part of the key: retries are often
+// saved into separate files with timestamps in their names.
+type TestKey struct {
+	Suite     string
+	ClassName string
+	Test      string
 }
 
-func NewClient(gcsClient *storage.Client) *Client {
-	return &Client{
-		gcsClient: gcsClient,
+func (r *TestResult) Key() TestKey {
+	return TestKey{
+		Suite:     r.Suite,
+		ClassName: r.ClassName,
+		Test:      r.Test,
 	}
 }
 
-func (c *Client) gcsListDir(ctx context.Context, bucket, prefix string) (dirs []string, files []string, err error) {
-	klog.V(4).Infof("Listing gs://%s/%s...", bucket, prefix)
-
-	bkt := c.gcsClient.Bucket(bucket)
-	q := &storage.Query{
-		Delimiter:  "/",
-		Prefix:     prefix,
-		Projection: storage.ProjectionNoACL,
-	}
-	q.SetAttrSelection([]string{"Name"})
-	it := bkt.Objects(ctx, q)
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to list objects in gs://%s/%s: %w", bucket, prefix, err)
-		}
-		if attrs.Prefix == "" {
-			files = append(files, attrs.Name)
-		} else {
-			dirs = append(dirs, attrs.Prefix)
+// String returns non-empty parts of the key separated by " | ".
+func (k TestKey) String() string {
+	var parts []string
+	for _, p := range []string{k.Suite, k.ClassName, k.Test} {
+		if p != "" {
+			parts = append(parts, p)
 		}
 	}
-	return dirs, files, nil
+	return strings.Join(parts, " | ")
 }
 
-func (c *Client) gcsListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
-	klog.V(4).Infof("Listing recursively gs://%s/%s...", bucket, prefix)
+type Client struct {
+	stores      map[string]Store
+	resultFiles *ResultFiles
+}
 
-	bkt := c.gcsClient.Bucket(bucket)
-	it := bkt.Objects(ctx, &storage.Query{
-		Prefix: prefix,
-	})
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to list all objects in gs://%s/%s: %w", bucket, prefix, err)
-		}
-		files = append(files, attrs.Name)
+// NewClient returns a client that reads artifacts from stores. The stores are
+// keyed by the URL scheme of their locations (gs, file, ...).
+func NewClient(stores map[string]Store) *Client {
+	return &Client{
+		stores:      stores,
+		resultFiles: &ResultFiles{},
 	}
-	return files, nil
 }
 
-func (c *Client) gcsOpen(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
-	klog.V(4).Infof("Downloading gs://%s/%s...", bucket, object)
+// SetResultFiles sets which files of builds are read by GetTestResults.
+func (c *Client) SetResultFiles(rf *ResultFiles) {
+	c.resultFiles = rf
+}
 
-	bkt := c.gcsClient.Bucket(bucket)
-	r, err := bkt.Object(object).NewReader(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, err)
+func (c *Client) storeFor(scheme string) (Store, error) {
+	if scheme == "" {
+		scheme = types.SchemeGCS
 	}
-
-	return r, nil
+	store, ok := c.stores[scheme]
+	if !ok {
+		return nil, fmt.Errorf("no artifact store for scheme %q", scheme)
+	}
+	return store, nil
 }
 
-func (c *Client) FindBuilds(ctx context.Context, name, gcsBucketPrefix string) ([]*types.Build, error) {
-	if !strings.HasSuffix(gcsBucketPrefix, "/") {
-		gcsBucketPrefix += "/"
+// ParseLocation splits a location like gs://bucket/prefix into its scheme,
+// bucket and prefix. Locations without a scheme are treated as GCS locations.
+func ParseLocation(location string) (scheme, bucket, prefix string, err error) {
+	scheme = types.SchemeGCS
+	if idx := strings.Index(location, "://"); idx != -1 {
+		scheme, location = location[:idx], location[idx+3:]
+	}
+	if !strings.HasSuffix(location, "/") {
+		location += "/"
+	}
+	parts := strings.SplitN(location, "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", "", fmt.Errorf("invalid location: %s", location)
 	}
-	parts := strings.SplitN(gcsBucketPrefix, "/", 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid gcs prefix for %s: %s", name, gcsBucketPrefix)
+	return scheme, parts[0], parts[1], nil
+}
+
+// prowBuildIDDigits is the number of digits in Prow build IDs. They are
+// positive int64 values, so they don't get longer.
+const prowBuildIDDigits = 19
+
+// canListSince reports whether builds with IDs that are not less than since
+// can be listed using since as a lexicographic start offset. This holds if
+// newer IDs cannot have more digits than since.
+func canListSince(since string) bool {
+	if _, err := strconv.ParseUint(since, 10, 64); err != nil {
+		// Non-numeric IDs are compared lexicographically anyway.
+		return true
 	}
-	bucket, prefix := parts[0], parts[1]
+	return len(since) >= prowBuildIDDigits
+}
 
-	klog.V(2).Infof("Searching for %s builds (gs://%s/%s)...", name, bucket, prefix)
+func (c *Client) findBuilds(ctx context.Context, store Store, name, scheme, bucket, prefix, since string) ([]*types.Build, error) {
+	startOffset := ""
+	if since != "" && canListSince(since) {
+		startOffset = prefix + since
+	}
 
 	var builds []*types.Build
-	dirs, _, err := c.gcsListDir(ctx, bucket, prefix)
+	dirs, files, err := store.ListDir(ctx, bucket, prefix, startOffset)
 	if err != nil {
 		return nil, err
 	}
 	for _, dir := range dirs {
 		if len(dir) <= len(prefix)+1 {
-			panic(fmt.Errorf("unexpected object from gcs: object is expected to have prefix %q, got %q", prefix, dir))
+			panic(fmt.Errorf("unexpected object from %s store: object is expected to have prefix %q, got %q", scheme, prefix, dir))
 		}
 		buildID := dir[len(prefix) : len(dir)-1]
+		if since != "" && LessBuildID(buildID, since) {
+			continue
+		}
 		build := &types.Build{
 			Job:       name,
 			BuildID:   buildID,
+			Scheme:    scheme,
 			GCSBucket: bucket,
 			GCSPrefix: dir,
 		}
+		SetPullInfoFromPath(build)
+		builds = append(builds, build)
+	}
+	for _, file := range files {
+		// pr-logs/directory/<job>/<build-id>.txt
+		if !strings.HasSuffix(file, ".txt") {
+			continue
+		}
+		buildID := strings.TrimSuffix(file[len(prefix):], ".txt")
+		if _, err := strconv.ParseUint(buildID, 10, 64); err != nil {
+			continue
+		}
+		if since != "" && LessBuildID(buildID, since) {
+			continue
+		}
+		build := &types.Build{
+			Job:       name,
+			BuildID:   buildID,
+			Scheme:    scheme,
+			GCSBucket: bucket,
+			GCSPrefix: file,
+		}
 		builds = append(builds, build)
 	}
+	// Stores list entries in lexicographic order, which is different from
+	// the order of numeric IDs with different number of digits.
+	sort.SliceStable(builds, func(i, j int) bool {
+		return LessBuildID(builds[i].BuildID, builds[j].BuildID)
+	})
 	return builds, nil
 }
 
+// FindBuilds finds builds of the job name in gcsBucketPrefix. The builds are
+// sorted by their IDs. If since is not empty, builds with IDs less than since
+// (see LessBuildID) are omitted. Only such builds are listed if the IDs cannot
+// get longer than since; otherwise the whole job directory is listed.
+func (c *Client) FindBuilds(ctx context.Context, name, gcsBucketPrefix, since string) ([]*types.Build, error) {
+	scheme, bucket, prefix, err := ParseLocation(gcsBucketPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcs prefix for %s: %w", name, err)
+	}
+
+	store, err := c.storeFor(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	if since != "" {
+		klog.V(2).Infof("Searching for %s builds since %s (%s://%s/%s)...", name, since, scheme, bucket, prefix)
+	} else {
+		klog.V(2).Infof("Searching for %s builds (%s://%s/%s)...", name, scheme, bucket, prefix)
+	}
+
+	return c.findBuilds(ctx, store, name, scheme, bucket, prefix, since)
+}
+
+// FindPullBuilds finds builds of the presubmit job name that are stored in
+// <pullsLocation>/<pull-number>/<name>/<build-id>/, where pullsLocation is
+// usually <bucket>/pr-logs/pull/<org_repo>/. The builds are sorted by their
+// IDs.
+func (c *Client) FindPullBuilds(ctx context.Context, name, pullsLocation string) ([]*types.Build, error) {
+	scheme, bucket, prefix, err := ParseLocation(pullsLocation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcs prefix for %s: %w", name, err)
+	}
+
+	store, err := c.storeFor(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.V(2).Infof("Searching for %s builds in pull requests (%s://%s/%s)...", name, scheme, bucket, prefix)
+
+	pulls, _, err := store.ListDir(ctx, bucket, prefix, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var builds []*types.Build
+	for _, pull := range pulls {
+		pullNumber := strings.TrimSuffix(pull[len(prefix):], "/")
+		if _, err := strconv.Atoi(pullNumber); err != nil {
+			// pr-logs/pull/batch/ and other non-PR directories
+			continue
+		}
+
+		pullBuilds, err := c.findBuilds(ctx, store, name, scheme, bucket, pull+name+"/", "")
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, pullBuilds...)
+	}
+
+	sort.Slice(builds, func(i, j int) bool {
+		return LessBuildID(builds[i].BuildID, builds[j].BuildID)
+	})
+
+	return builds, nil
+}
+
+// LessBuildID reports whether the build ID a should sort before b. Numeric IDs
+// are compared as numbers.
+func LessBuildID(a, b string) bool {
+	if len(a) != len(b) {
+		_, errA := strconv.ParseUint(a, 10, 64)
+		_, errB := strconv.ParseUint(b, 10, 64)
+		if errA == nil && errB == nil {
+			return len(a) < len(b)
+		}
+	}
+	return a < b
+}
+
 func (c *Client) GetBuildFiles(ctx context.Context, build *types.Build) (*types.BuildFiles, error) {
-	files, err := c.gcsListFiles(ctx, build.GCSBucket, build.GCSPrefix)
+	store, err := c.storeFor(build.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := store.ListFiles(ctx, build.GCSBucket, build.GCSPrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -186,41 +365,45 @@ func (c *Client) GetBuildFiles(ctx context.Context, build *types.Build) (*types.
 	}, nil
 }
 
-func (c *Client) GetStartedJson(ctx context.Context, build *types.Build) (StartedJson, error) {
-	var j StartedJson
-	f, err := c.gcsOpen(ctx, build.GCSBucket, build.GCSPrefix+"started.json")
+func (c *Client) getJSON(ctx context.Context, build *types.Build, filename string, v interface{}) error {
+	store, err := c.storeFor(build.Scheme)
+	if err != nil {
+		return err
+	}
+	f, err := store.Open(ctx, build.GCSBucket, build.GCSPrefix+filename)
 	if err != nil {
-		return j, err
+		return err
 	}
 	defer f.Close()
-	err = json.NewDecoder(f).Decode(&j)
+	err = json.NewDecoder(f).Decode(v)
 	if err != nil {
-		return j, InvalidJSONError{
-			msg: fmt.Sprintf("unable to decode gs://%s/%s", build.GCSBucket, build.GCSPrefix+"started.json"),
+		return InvalidJSONError{
+			msg: fmt.Sprintf("unable to decode %s", build.URL()+filename),
 			err: err,
 		}
 	}
-	return j, nil
+	return nil
+}
+
+func (c *Client) GetStartedJson(ctx context.Context, build *types.Build) (StartedJson, error) {
+	var j StartedJson
+	err := c.getJSON(ctx, build, "started.json", &j)
+	return j, err
 }
 
 func (c *Client) GetFinishedJson(ctx context.Context, build *types.Build) (FinishedJson, error) {
 	var j FinishedJson
-	f, err := c.gcsOpen(ctx, build.GCSBucket, build.GCSPrefix+"finished.json")
-	if err != nil {
-		return j, err
-	}
-	defer f.Close()
-	err = json.NewDecoder(f).Decode(&j)
-	if err != nil {
-		return j, InvalidJSONError{
-			msg: fmt.Sprintf("unable to decode gs://%s/%s", build.GCSBucket, build.GCSPrefix+"finished.json"),
-			err: err,
-		}
-	}
-	return j, nil
+	err := c.getJSON(ctx, build, "finished.json", &j)
+	return j, err
 }
 
-func analyzeSuite(suite junit.Suite) []*TestResult {
+func (c *Client) GetProwJobJson(ctx context.Context, build *types.Build) (ProwJobJson, error) {
+	var j ProwJobJson
+	err := c.getJSON(ctx, build, "prowjob.json", &j)
+	return j, err
+}
+
+func analyzeSuite(file string, suite junit.Suite) []*TestResult {
 	var results []*TestResult
 	for _, result := range suite.Results {
 		var output string
@@ -243,41 +426,61 @@ func analyzeSuite(suite junit.Suite) []*TestResult {
 			status = TestStatusSkipped
 		}
 
+		var properties map[string]string
+		if result.Properties != nil && len(result.Properties.PropertyList) > 0 {
+			properties = make(map[string]string, len(result.Properties.PropertyList))
+			for _, p := range result.Properties.PropertyList {
+				properties[p.Name] = p.Value
+			}
+		}
+
 		results = append(results, &TestResult{
-			Test:    result.Name,
-			Status:  status,
-			Output:  output,
-			Summary: summary,
+			Test:       result.Name,
+			Status:     status,
+			Output:     output,
+			Summary:    summary,
+			Suite:      suite.Name,
+			ClassName:  result.ClassName,
+			File:       file,
+			Properties: properties,
+			Duration:   result.Time,
 		})
 	}
 	return results
 }
 
-func analyzeSuites(suites []junit.Suite) []*TestResult {
+func analyzeSuites(file string, suites []junit.Suite) []*TestResult {
 	var results []*TestResult
 	for _, suite := range suites {
-		results = append(results, analyzeSuite(suite)...)
+		results = append(results, analyzeSuite(file, suite)...)
 	}
 	return results
 }
 
 func (c *Client) GetTestResults(ctx context.Context, buildFiles *types.BuildFiles) ([]*TestResult, error) {
+	store, err := c.storeFor(buildFiles.Build.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
 	var results []*TestResult
 	for objectName := range buildFiles.Files {
-		if junitObject.MatchString(objectName) {
-			f, err := c.gcsOpen(ctx, buildFiles.Build.GCSBucket, objectName)
-			if err != nil {
-				return results, err
-			}
-			suites, err := junit.ParseStream(f)
-			if err != nil {
-				klog.Warningf("unable to parse gs://%s/%s: %w", buildFiles.Build.GCSBucket, objectName, err)
-				continue
-			}
-			testResults := analyzeSuites(suites.Suites)
-			f.Close()
-			results = append(results, testResults...)
+		parse := c.resultFiles.parserFor(buildFiles.Build.Job, objectName)
+		if parse == nil {
+			continue
+		}
+		f, err := store.Open(ctx, buildFiles.Build.GCSBucket, objectName)
+		if err != nil {
+			return results, err
+		}
+		file := strings.TrimPrefix(objectName, buildFiles.Build.GCSPrefix)
+		testResults, err := parse(file, f)
+		f.Close()
+		if err != nil {
+			klog.Warningf("unable to parse %s: %v", buildFiles.Build.ObjectURL(objectName), err)
+			continue
 		}
+		results = append(results, testResults...)
 	}
 	return results, nil
 }
@@ -0,0 +1,140 @@
+package artifacts
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dmage/triage/pkg/types"
+)
+
+func TestLessBuildID(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{"1", "2", true},
+		{"2", "1", false},
+		{"1", "1", false},
+		{"999", "1000", true},
+		{"1000", "999", false},
+		{"1445678901234567890", "1445678901234567891", true},
+		{"9", "1445678901234567890", true},
+		{"abc", "abd", true},
+		{"1000", "abc", true},
+		{"abc", "999", false},
+	}
+	for _, tc := range testCases {
+		if got := LessBuildID(tc.a, tc.b); got != tc.want {
+			t.Errorf("LessBuildID(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// listingStore is a store with a flat list of objects that records start
+// offsets of listings.
+type listingStore struct {
+	objects      []string
+	startOffsets []string
+}
+
+func (s *listingStore) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	s.startOffsets = append(s.startOffsets, startOffset)
+	seen := make(map[string]bool)
+	for _, obj := range s.objects {
+		if !strings.HasPrefix(obj, prefix) {
+			continue
+		}
+		rest := obj[len(prefix):]
+		if idx := strings.Index(rest, "/"); idx != -1 {
+			dir := prefix + rest[:idx+1]
+			if dir >= startOffset && !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		} else if obj >= startOffset {
+			files = append(files, obj)
+		}
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+	return dirs, files, nil
+}
+
+func (s *listingStore) ListFiles(ctx context.Context, bucket, prefix string) ([]string, error) {
+	panic("not implemented")
+}
+
+func (s *listingStore) Open(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+	panic("not implemented")
+}
+
+func (s *listingStore) OpenTail(ctx context.Context, bucket, object string, n int64) (io.ReadCloser, error) {
+	panic("not implemented")
+}
+
+func TestFindBuildsSince(t *testing.T) {
+	testCases := []struct {
+		name            string
+		builds          []string
+		since           string
+		wantBuilds      []string
+		wantStartOffset string
+	}{
+		{
+			name:            "all builds",
+			builds:          []string{"1000", "998", "999"},
+			since:           "",
+			wantBuilds:      []string{"998", "999", "1000"},
+			wantStartOffset: "",
+		},
+		{
+			name:            "build IDs gain a digit",
+			builds:          []string{"1000", "1001", "998", "999"},
+			since:           "999",
+			wantBuilds:      []string{"999", "1000", "1001"},
+			wantStartOffset: "",
+		},
+		{
+			name:            "prow build IDs",
+			builds:          []string{"1445678901234567889", "1445678901234567890", "1445678901234567891"},
+			since:           "1445678901234567890",
+			wantBuilds:      []string{"1445678901234567890", "1445678901234567891"},
+			wantStartOffset: "logs/job/1445678901234567890",
+		},
+		{
+			name:            "non-numeric build IDs",
+			builds:          []string{"build-a", "build-b", "build-c"},
+			since:           "build-b",
+			wantBuilds:      []string{"build-b", "build-c"},
+			wantStartOffset: "logs/job/build-b",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &listingStore{}
+			for _, b := range tc.builds {
+				store.objects = append(store.objects, "logs/job/"+b+"/started.json")
+			}
+			client := NewClient(map[string]Store{types.SchemeFile: store})
+
+			builds, err := client.FindBuilds(context.Background(), "job", "file://bucket/logs/job", tc.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range builds {
+				got = append(got, b.BuildID)
+			}
+			if !reflect.DeepEqual(got, tc.wantBuilds) {
+				t.Errorf("builds: got %q, want %q", got, tc.wantBuilds)
+			}
+			if want := []string{tc.wantStartOffset}; !reflect.DeepEqual(store.startOffsets, want) {
+				t.Errorf("start offsets: got %q, want %q", store.startOffsets, want)
+			}
+		})
+	}
+}
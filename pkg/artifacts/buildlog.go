@@ -0,0 +1,166 @@
+package artifacts
+
+import (
+	"context"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dmage/triage/pkg/types"
+)
+
+// JobFailureTest is the name of synthetic tests that represent failures of
+// builds without test results.
+const JobFailureTest = "[job] build failed"
+
+const (
+	// maxLogTail is the maximum size of the tail of a build log that is kept
+	// as the output of a job failure.
+	maxLogTail = 64 << 10 // 64 KiB
+
+	// logSummaryLines is the number of the last lines of a build log that
+	// are used as the failure text.
+	logSummaryLines = 30
+)
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// stepFinishedJson is finished.json of a step of a multi-stage job.
+type stepFinishedJson struct {
+	Timestamp int64  `json:"timestamp"`
+	Passed    *bool  `json:"passed,omitempty"`
+	Result    string `json:"result"`
+}
+
+func (j stepFinishedJson) failed() bool {
+	return j.Result == "FAILURE" || (j.Passed != nil && !*j.Passed)
+}
+
+// tailWriter keeps the last max bytes that are written to it.
+type tailWriter struct {
+	max int
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > w.max {
+		p = p[len(p)-w.max:]
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.max {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.max:]...)
+	}
+	return n, nil
+}
+
+func (c *Client) readLogTail(ctx context.Context, build *types.Build, filename string) (string, error) {
+	store, err := c.storeFor(build.Scheme)
+	if err != nil {
+		return "", err
+	}
+	f, err := store.OpenTail(ctx, build.GCSBucket, build.GCSPrefix+filename, maxLogTail)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Stores may return the whole object.
+	w := &tailWriter{max: maxLogTail}
+	if _, err := io.Copy(w, f); err != nil {
+		return "", err
+	}
+
+	tail := string(w.buf)
+	if len(w.buf) == maxLogTail {
+		// The first line is likely to be cut.
+		if idx := strings.Index(tail, "\n"); idx != -1 {
+			tail = tail[idx+1:]
+		}
+	}
+	tail = strings.ToValidUTF8(tail, string(utf8.RuneError))
+	return ansiEscape.ReplaceAllString(tail, ""), nil
+}
+
+// failedStep returns the directory of the earliest failed step of a
+// multi-stage job that has build-log.txt, or an empty string if there are no
+// such steps.
+func (c *Client) failedStep(ctx context.Context, buildFiles *types.BuildFiles) (string, error) {
+	prefix := buildFiles.Build.GCSPrefix
+	var steps []string
+	for objectName := range buildFiles.Files {
+		name := strings.TrimPrefix(objectName, prefix)
+		if !strings.HasPrefix(name, "artifacts/") || path.Base(name) != "finished.json" {
+			continue
+		}
+		dir := path.Dir(name) + "/"
+		if buildFiles.Has(dir + "build-log.txt") {
+			steps = append(steps, dir)
+		}
+	}
+	sort.Strings(steps)
+
+	failed := ""
+	var failedAt int64
+	for _, dir := range steps {
+		var j stepFinishedJson
+		err := c.getJSON(ctx, buildFiles.Build, dir+"finished.json", &j)
+		if IsInvalidJSON(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if j.failed() && (failed == "" || j.Timestamp < failedAt) {
+			failed, failedAt = dir, j.Timestamp
+		}
+	}
+	return failed, nil
+}
+
+// GetJobFailure returns a synthetic failed test for a build that failed
+// without test results. Its output is the tail of the log of the earliest
+// failed step, or of build-log.txt if there are no failed steps. It returns
+// nil if the build doesn't have logs.
+func (c *Client) GetJobFailure(ctx context.Context, buildFiles *types.BuildFiles) (*TestResult, error) {
+	step, err := c.failedStep(ctx, buildFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	test := JobFailureTest
+	if step != "" {
+		test += " in " + strings.TrimSuffix(strings.TrimPrefix(step, "artifacts/"), "/")
+	}
+	logFile := step + "build-log.txt"
+	if !buildFiles.Has(logFile) {
+		return nil, nil
+	}
+
+	output, err := c.readLogTail(ctx, buildFiles.Build, logFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blank lines are dropped as the failure text is cut at the first one.
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > logSummaryLines {
+		lines = lines[len(lines)-logSummaryLines:]
+	}
+
+	return &TestResult{
+		Test:      test,
+		Status:    TestStatusFailure,
+		Output:    output,
+		Summary:   strings.Join(lines, "\n"),
+		File:      logFile,
+		Synthetic: true,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+type fileStore struct {
+	root string
+}
+
+// NewFileStore returns a store that reads artifacts from a local directory.
+// Every subdirectory of root is treated as a bucket, so the object
+// logs/job/1/started.json from the bucket ci is read from
+// <root>/ci/logs/job/1/started.json.
+func NewFileStore(root string) Store {
+	return &fileStore{
+		root: root,
+	}
+}
+
+func (s *fileStore) pathFor(bucket, object string) (string, error) {
+	if bucket == "" || strings.ContainsRune(bucket, '/') || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	for _, elem := range strings.Split(object, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("invalid object name %q", object)
+		}
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(object)), nil
+}
+
+// splitPrefix splits prefix into a directory part that ends with a slash (or
+// is empty) and a partial name of entries from this directory.
+func splitPrefix(prefix string) (dir, name string) {
+	idx := strings.LastIndex(prefix, "/")
+	return prefix[:idx+1], prefix[idx+1:]
+}
+
+func (s *fileStore) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	klog.V(4).Infof("Listing file://%s/%s...", bucket, prefix)
+
+	dir, name := splitPrefix(prefix)
+	p, err := s.pathFor(bucket, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to list objects in file://%s/%s: %w", bucket, prefix, err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), name) {
+			continue
+		}
+		if entry.IsDir() {
+			if dir+entry.Name()+"/" >= startOffset {
+				dirs = append(dirs, dir+entry.Name()+"/")
+			}
+		} else {
+			if dir+entry.Name() >= startOffset {
+				files = append(files, dir+entry.Name())
+			}
+		}
+	}
+	return dirs, files, nil
+}
+
+func (s *fileStore) ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
+	klog.V(4).Infof("Listing recursively file://%s/%s...", bucket, prefix)
+
+	dir, _ := splitPrefix(prefix)
+	p, err := s.pathFor(bucket, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(p, func(filename string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && filename == p {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p, filename)
+		if err != nil {
+			return err
+		}
+		object := path.Join(dir, filepath.ToSlash(rel))
+		if strings.HasPrefix(object, prefix) {
+			files = append(files, object)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all objects in file://%s/%s: %w", bucket, prefix, err)
+	}
+	return files, nil
+}
+
+func (s *fileStore) Open(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
+	klog.V(4).Infof("Reading file://%s/%s...", bucket, object)
+
+	p, err := s.pathFor(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, err)
+	}
+
+	return f, nil
+}
+
+func (s *fileStore) OpenTail(ctx context.Context, bucket string, object string, n int64) (io.ReadCloser, error) {
+	klog.V(4).Infof("Reading the last %d bytes of file://%s/%s...", n, bucket, object)
+
+	p, err := s.pathFor(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, err)
+	}
+	if fi.Size() > n {
+		if _, err := f.Seek(fi.Size()-n, io.SeekStart); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to open file://%s/%s: %w", bucket, object, err)
+		}
+	}
+	return f, nil
+}
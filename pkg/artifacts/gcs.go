@@ -0,0 +1,127 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"k8s.io/klog/v2"
+)
+
+type gcsStore struct {
+	client        *storage.Client
+	bucketClients map[string]*storage.Client
+}
+
+// NewGCSStore returns a store that reads artifacts from Google Cloud Storage.
+func NewGCSStore(client *storage.Client) Store {
+	return NewGCSStoreWithBucketClients(client, nil)
+}
+
+// NewGCSStoreWithBucketClients returns a store that reads artifacts from
+// Google Cloud Storage using clients from bucketClients for their buckets,
+// and client for other buckets.
+func NewGCSStoreWithBucketClients(client *storage.Client, bucketClients map[string]*storage.Client) Store {
+	return &gcsStore{
+		client:        client,
+		bucketClients: bucketClients,
+	}
+}
+
+func (s *gcsStore) bucket(name string) *storage.BucketHandle {
+	if client, ok := s.bucketClients[name]; ok {
+		return client.Bucket(name)
+	}
+	return s.client.Bucket(name)
+}
+
+func (s *gcsStore) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	klog.V(4).Infof("Listing gs://%s/%s...", bucket, prefix)
+
+	bkt := s.bucket(bucket)
+	q := &storage.Query{
+		Delimiter:   "/",
+		Prefix:      prefix,
+		StartOffset: startOffset,
+		Projection:  storage.ProjectionNoACL,
+	}
+	q.SetAttrSelection([]string{"Name"})
+	it := bkt.Objects(ctx, q)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list objects in gs://%s/%s: %w", bucket, prefix, err)
+		}
+		if attrs.Prefix == "" {
+			files = append(files, attrs.Name)
+		} else {
+			dirs = append(dirs, attrs.Prefix)
+		}
+	}
+	return dirs, files, nil
+}
+
+func (s *gcsStore) ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
+	klog.V(4).Infof("Listing recursively gs://%s/%s...", bucket, prefix)
+
+	bkt := s.bucket(bucket)
+	it := bkt.Objects(ctx, &storage.Query{
+		Prefix: prefix,
+	})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list all objects in gs://%s/%s: %w", bucket, prefix, err)
+		}
+		files = append(files, attrs.Name)
+	}
+	return files, nil
+}
+
+func (s *gcsStore) Open(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading gs://%s/%s...", bucket, object)
+
+	bkt := s.bucket(bucket)
+	r, err := bkt.Object(object).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, err)
+	}
+
+	return r, nil
+}
+
+func (s *gcsStore) OpenTail(ctx context.Context, bucket string, object string, n int64) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading the last %d bytes of gs://%s/%s...", n, bucket, object)
+
+	obj := s.bucket(bucket).Object(object)
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, err)
+	}
+
+	var offset int64
+	if attrs.Size > n {
+		offset = attrs.Size - n
+	}
+	r, err := obj.NewRangeReader(ctx, offset, -1)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open gs://%s/%s: %w", bucket, object, err)
+	}
+
+	return r, nil
+}
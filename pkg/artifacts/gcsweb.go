@@ -0,0 +1,232 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var hrefRe = regexp.MustCompile(`(?i)href\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+type gcswebStore struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// NewGCSWebStore returns a read-only store that discovers objects by parsing
+// directory listings served by gcsweb or by a plain HTTP server (for example,
+// nginx with autoindex), and downloads objects over HTTP. The bucket bkt is
+// expected to be available at <baseURL>/bkt/.
+func NewGCSWebStore(baseURL string, httpClient *http.Client) (Store, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcsweb url %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid gcsweb url %q: scheme should be http or https", baseURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &gcswebStore{
+		baseURL:    u,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (s *gcswebStore) urlFor(bucket, object string) *url.URL {
+	return s.baseURL.ResolveReference(&url.URL{Path: bucket + "/" + object})
+}
+
+func (s *gcswebStore) get(ctx context.Context, u *url.URL, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return s.httpClient.Do(req)
+}
+
+type jsonListingEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// parseListing returns names of the entries from the listing of the directory
+// dirURL that contains objects <bucket>/<dir>. Names of subdirectories end
+// with a slash.
+func parseListing(dirURL *url.URL, bucket, dir, contentType string, body []byte) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" {
+		// nginx autoindex_format json
+		var entries []jsonListingEntry
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, e := range entries {
+			if e.Name == "" || e.Name == "." || e.Name == ".." || strings.Contains(e.Name, "/") {
+				continue
+			}
+			if e.Type == "directory" {
+				names = append(names, e.Name+"/")
+			} else {
+				names = append(names, e.Name)
+			}
+		}
+		return names, nil
+	}
+
+	// gcsweb links subdirectories to the listings on its own host, but files
+	// are linked to https://storage.googleapis.com/<bucket>/<object>. Links
+	// are matched by their <bucket>/<dir>/ part regardless of the host and
+	// the path where the bucket is mounted.
+	objectDir := "/" + bucket + "/" + dir
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range hrefRe.FindAllSubmatch(body, -1) {
+		href := string(m[1])
+		if href == "" {
+			href = string(m[2])
+		}
+		ref, err := url.Parse(html.UnescapeString(href))
+		if err != nil {
+			continue
+		}
+		u := dirURL.ResolveReference(ref)
+		idx := strings.Index(u.Path, objectDir)
+		if idx == -1 {
+			continue
+		}
+		name := u.Path[idx+len(objectDir):]
+		if name == "" || name == "/" {
+			continue
+		}
+		// Only immediate children of the directory.
+		if idx := strings.Index(name, "/"); idx != -1 && idx != len(name)-1 {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *gcswebStore) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	klog.V(4).Infof("Listing gcsweb://%s/%s...", bucket, prefix)
+
+	dir, name := splitPrefix(prefix)
+	dirURL := s.urlFor(bucket, dir)
+
+	resp, err := s.get(ctx, dirURL, http.Header{"Accept": {"application/json, text/html;q=0.9, */*;q=0.8"}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list objects in gcsweb://%s/%s: %w", bucket, prefix, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to list objects in gcsweb://%s/%s: %w", bucket, prefix, newHTTPStatusError(resp))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list objects in gcsweb://%s/%s: %w", bucket, prefix, err)
+	}
+
+	// The server may have redirected us, links are relative to the final URL.
+	names, err := parseListing(resp.Request.URL, bucket, dir, resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse listing of gcsweb://%s/%s: %w", bucket, prefix, err)
+	}
+	for _, n := range names {
+		if !strings.HasPrefix(n, name) || dir+n < startOffset {
+			continue
+		}
+		if strings.HasSuffix(n, "/") {
+			dirs = append(dirs, dir+n)
+		} else {
+			files = append(files, dir+n)
+		}
+	}
+	return dirs, files, nil
+}
+
+func (s *gcswebStore) ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
+	klog.V(4).Infof("Listing recursively gcsweb://%s/%s...", bucket, prefix)
+
+	queue := []string{prefix}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		dirs, fs, err := s.ListDir(ctx, bucket, p, "")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fs...)
+		queue = append(queue, dirs...)
+	}
+	return files, nil
+}
+
+func (s *gcswebStore) Open(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading gcsweb://%s/%s...", bucket, object)
+
+	resp, err := s.get(ctx, s.urlFor(bucket, object), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := newHTTPStatusError(resp)
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *gcswebStore) OpenTail(ctx context.Context, bucket string, object string, n int64) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading the last %d bytes of gcsweb://%s/%s...", n, bucket, object)
+
+	resp, err := s.get(ctx, s.urlFor(bucket, object), http.Header{"Range": {tailRange(n)}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return emptyBody(), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, ErrNotFound)
+	}
+	err = newHTTPStatusError(resp)
+	resp.Body.Close()
+	return nil, fmt.Errorf("failed to open gcsweb://%s/%s: %w", bucket, object, err)
+}
@@ -0,0 +1,119 @@
+package artifacts
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseListing(t *testing.T) {
+	gcswebPage, err := ioutil.ReadFile("testdata/gcsweb.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		dirURL      string
+		bucket      string
+		dir         string
+		contentType string
+		body        string
+		want        []string
+	}{
+		{
+			name:        "gcsweb",
+			dirURL:      "https://gcsweb.example.com/gcs/origin-ci-test/logs/periodic-e2e/1445678901234567890/",
+			bucket:      "origin-ci-test",
+			dir:         "logs/periodic-e2e/1445678901234567890/",
+			contentType: "text/html; charset=utf-8",
+			body:        string(gcswebPage),
+			want:        []string{"artifacts/", "build-log.txt", "finished.json", "started.json"},
+		},
+		{
+			name:        "autoindex html",
+			dirURL:      "http://artifacts.example.com/bucket/logs/job/",
+			bucket:      "bucket",
+			dir:         "logs/job/",
+			contentType: "text/html",
+			body:        `<a href="../">../</a><a href="100/">100/</a><a href='101/'>101/</a><a href="latest-build.txt">latest-build.txt</a><a href="100/">100/</a>`,
+			want:        []string{"100/", "101/", "latest-build.txt"},
+		},
+		{
+			name:        "nested entries are ignored",
+			dirURL:      "http://artifacts.example.com/bucket/logs/",
+			bucket:      "bucket",
+			dir:         "logs/",
+			contentType: "text/html",
+			body:        `<a href="job/100/finished.json">x</a><a href="job/">job/</a><a href="http://other.example.com/">other</a>`,
+			want:        []string{"job/"},
+		},
+		{
+			name:        "autoindex json",
+			dirURL:      "http://artifacts.example.com/bucket/logs/job/",
+			bucket:      "bucket",
+			dir:         "logs/job/",
+			contentType: "application/json",
+			body:        `[{"name":"100","type":"directory"},{"name":"latest-build.txt","type":"file"},{"name":"..","type":"directory"}]`,
+			want:        []string{"100/", "latest-build.txt"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirURL, err := url.Parse(tc.dirURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseListing(dirURL, tc.bucket, tc.dir, tc.contentType, []byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGCSWebStoreListDir(t *testing.T) {
+	gcswebPage, err := ioutil.ReadFile("testdata/gcsweb.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gcs/origin-ci-test/logs/periodic-e2e/1445678901234567890/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(gcswebPage)
+	}))
+	defer srv.Close()
+
+	store, err := NewGCSWebStore(srv.URL+"/gcs/", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, files, err := store.ListDir(context.Background(), "origin-ci-test", "logs/periodic-e2e/1445678901234567890/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDirs := []string{"logs/periodic-e2e/1445678901234567890/artifacts/"}
+	wantFiles := []string{
+		"logs/periodic-e2e/1445678901234567890/build-log.txt",
+		"logs/periodic-e2e/1445678901234567890/finished.json",
+		"logs/periodic-e2e/1445678901234567890/started.json",
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("dirs: got %q, want %q", dirs, wantDirs)
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("files: got %q, want %q", files, wantFiles)
+	}
+}
@@ -0,0 +1,179 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ginkgoReport is the subset of a Ginkgo v2 suite report from report.json.
+type ginkgoReport struct {
+	SuiteDescription string
+	SpecReports      []ginkgoSpecReport
+}
+
+type ginkgoCodeLocation struct {
+	FileName       string
+	LineNumber     int
+	FullStackTrace string
+}
+
+func (l ginkgoCodeLocation) String() string {
+	if l.FileName == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", l.FileName, l.LineNumber)
+}
+
+type ginkgoProgressReport struct {
+	Message         string
+	CurrentNodeType string
+	CurrentNodeText string
+	CurrentStepText string
+}
+
+func (p ginkgoProgressReport) String() string {
+	var b strings.Builder
+	if p.Message != "" {
+		fmt.Fprintf(&b, "%s\n", p.Message)
+	}
+	if p.CurrentNodeType != "" {
+		fmt.Fprintf(&b, "In [%s] %s\n", p.CurrentNodeType, p.CurrentNodeText)
+	}
+	if p.CurrentStepText != "" {
+		fmt.Fprintf(&b, "At step: %s\n", p.CurrentStepText)
+	}
+	return b.String()
+}
+
+type ginkgoFailure struct {
+	Message        string
+	Location       ginkgoCodeLocation
+	ForwardedPanic string
+	ProgressReport ginkgoProgressReport
+}
+
+type ginkgoSpecReport struct {
+	ContainerHierarchyTexts    []string
+	ContainerHierarchyLabels   [][]string
+	LeafNodeType               string
+	LeafNodeText               string
+	LeafNodeLabels             []string
+	State                      string
+	RunTime                    time.Duration
+	Failure                    ginkgoFailure
+	CapturedGinkgoWriterOutput string
+	CapturedStdOutErr          string
+	ProgressReports            []ginkgoProgressReport
+}
+
+func (s ginkgoSpecReport) labels() []string {
+	seen := make(map[string]bool)
+	var labels []string
+	add := func(ls []string) {
+		for _, l := range ls {
+			if !seen[l] {
+				seen[l] = true
+				labels = append(labels, l)
+			}
+		}
+	}
+	for _, ls := range s.ContainerHierarchyLabels {
+		add(ls)
+	}
+	add(s.LeafNodeLabels)
+	return labels
+}
+
+// name returns the name of the spec as it is reported by Ginkgo in junit
+// files, so that results from both formats are grouped together.
+func (s ginkgoSpecReport) name() string {
+	name := fmt.Sprintf("[%s]", s.LeafNodeType)
+	texts := s.ContainerHierarchyTexts
+	if s.LeafNodeText != "" {
+		texts = append(texts[:len(texts):len(texts)], s.LeafNodeText)
+	}
+	if fullText := strings.Join(texts, " "); fullText != "" {
+		name += " " + fullText
+	}
+	if labels := s.labels(); len(labels) > 0 {
+		name += " [" + strings.Join(labels, ", ") + "]"
+	}
+	return name
+}
+
+func (s ginkgoSpecReport) status() TestStatus {
+	switch s.State {
+	case "passed":
+		return TestStatusSuccess
+	case "skipped", "pending":
+		return TestStatusSkipped
+	}
+	// failed, timedout, panicked, interrupted, aborted
+	return TestStatusFailure
+}
+
+func (s ginkgoSpecReport) summary() string {
+	summary := s.Failure.Message
+	if s.Failure.ForwardedPanic != "" {
+		summary += "\n" + s.Failure.ForwardedPanic
+	}
+	return summary
+}
+
+func (s ginkgoSpecReport) output() string {
+	var b strings.Builder
+	if s.State != "passed" && s.State != "skipped" && s.State != "pending" {
+		fmt.Fprintf(&b, "[%s] %s\n", strings.ToUpper(s.State), s.summary())
+		if location := s.Failure.Location.String(); location != "" {
+			fmt.Fprintf(&b, "In %s\n", location)
+		}
+		if s.Failure.Location.FullStackTrace != "" {
+			fmt.Fprintf(&b, "\nFull Stack Trace\n%s\n", s.Failure.Location.FullStackTrace)
+		}
+		if report := s.Failure.ProgressReport.String(); report != "" {
+			fmt.Fprintf(&b, "\n%s", report)
+		}
+	}
+	for _, p := range s.ProgressReports {
+		fmt.Fprintf(&b, "\nProgress Report\n%s", p)
+	}
+	if s.CapturedGinkgoWriterOutput != "" {
+		fmt.Fprintf(&b, "\n%s", s.CapturedGinkgoWriterOutput)
+	}
+	if s.CapturedStdOutErr != "" {
+		fmt.Fprintf(&b, "\n%s", s.CapturedStdOutErr)
+	}
+	return b.String()
+}
+
+// parseGinkgoReport reads test results from a Ginkgo v2 JSON report
+// (ginkgo --json-report).
+func parseGinkgoReport(file string, r io.Reader) ([]*TestResult, error) {
+	var reports []ginkgoReport
+	if err := json.NewDecoder(r).Decode(&reports); err != nil {
+		return nil, err
+	}
+
+	var results []*TestResult
+	for _, report := range reports {
+		for _, spec := range report.SpecReports {
+			results = append(results, &TestResult{
+				Test:            spec.name(),
+				Status:          spec.status(),
+				Output:          spec.output(),
+				Summary:         spec.summary(),
+				Suite:           report.SuiteDescription,
+				ClassName:       report.SuiteDescription,
+				File:            file,
+				Labels:          spec.labels(),
+				FailureLocation: spec.Failure.Location.String(),
+				StackTrace:      spec.Failure.Location.FullStackTrace,
+				Duration:        spec.RunTime.Seconds(),
+			})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,192 @@
+package artifacts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGinkgoReport(t *testing.T) {
+	testCases := []struct {
+		name   string
+		report string
+		want   []*TestResult
+	}{
+		{
+			name:   "empty report",
+			report: `[{"SuiteDescription": "Kubernetes e2e suite", "SpecReports": null}]`,
+			want:   nil,
+		},
+		{
+			name: "passed spec",
+			report: `[{
+				"SuiteDescription": "Kubernetes e2e suite",
+				"SpecReports": [{
+					"ContainerHierarchyTexts": ["[sig-node] Pods"],
+					"ContainerHierarchyLabels": [["Conformance"]],
+					"LeafNodeType": "It",
+					"LeafNodeText": "should run",
+					"LeafNodeLabels": ["Slow", "Conformance"],
+					"State": "passed",
+					"RunTime": 1500000000
+				}]
+			}]`,
+			want: []*TestResult{{
+				Test:      "[It] [sig-node] Pods should run [Conformance, Slow]",
+				Status:    TestStatusSuccess,
+				Suite:     "Kubernetes e2e suite",
+				ClassName: "Kubernetes e2e suite",
+				File:      "artifacts/report.json",
+				Labels:    []string{"Conformance", "Slow"},
+				Duration:  1.5,
+			}},
+		},
+		{
+			name: "suite node",
+			report: `[{
+				"SuiteDescription": "Kubernetes e2e suite",
+				"SpecReports": [{
+					"LeafNodeType": "SynchronizedBeforeSuite",
+					"State": "passed"
+				}]
+			}]`,
+			want: []*TestResult{{
+				Test:      "[SynchronizedBeforeSuite]",
+				Status:    TestStatusSuccess,
+				Suite:     "Kubernetes e2e suite",
+				ClassName: "Kubernetes e2e suite",
+				File:      "artifacts/report.json",
+			}},
+		},
+		{
+			name: "skipped and pending specs",
+			report: `[{
+				"SuiteDescription": "suite",
+				"SpecReports": [
+					{"ContainerHierarchyTexts": ["a"], "LeafNodeType": "It", "LeafNodeText": "is skipped", "State": "skipped"},
+					{"ContainerHierarchyTexts": ["a"], "LeafNodeType": "It", "LeafNodeText": "is pending", "State": "pending"}
+				]
+			}]`,
+			want: []*TestResult{
+				{Test: "[It] a is skipped", Status: TestStatusSkipped, Suite: "suite", ClassName: "suite", File: "artifacts/report.json"},
+				{Test: "[It] a is pending", Status: TestStatusSkipped, Suite: "suite", ClassName: "suite", File: "artifacts/report.json"},
+			},
+		},
+		{
+			name: "failed spec",
+			report: `[{
+				"SuiteDescription": "suite",
+				"SpecReports": [{
+					"ContainerHierarchyTexts": ["[sig-node] Pods"],
+					"LeafNodeType": "It",
+					"LeafNodeText": "should run",
+					"State": "failed",
+					"Failure": {
+						"Message": "expected pod to be running",
+						"Location": {"FileName": "test/e2e/pods.go", "LineNumber": 42, "FullStackTrace": "main.test()"}
+					},
+					"CapturedGinkgoWriterOutput": "STEP: creating a pod"
+				}]
+			}]`,
+			want: []*TestResult{{
+				Test:   "[It] [sig-node] Pods should run",
+				Status: TestStatusFailure,
+				Output: "[FAILED] expected pod to be running\n" +
+					"In test/e2e/pods.go:42\n" +
+					"\nFull Stack Trace\nmain.test()\n" +
+					"\nSTEP: creating a pod",
+				Summary:         "expected pod to be running",
+				Suite:           "suite",
+				ClassName:       "suite",
+				File:            "artifacts/report.json",
+				FailureLocation: "test/e2e/pods.go:42",
+				StackTrace:      "main.test()",
+			}},
+		},
+		{
+			name: "panicked spec with progress report",
+			report: `[{
+				"SuiteDescription": "suite",
+				"SpecReports": [{
+					"ContainerHierarchyTexts": ["a"],
+					"LeafNodeType": "It",
+					"LeafNodeText": "panics",
+					"State": "panicked",
+					"Failure": {
+						"Message": "Test Panicked",
+						"ForwardedPanic": "runtime error: index out of range",
+						"ProgressReport": {"CurrentNodeType": "It", "CurrentNodeText": "panics", "CurrentStepText": "indexing"}
+					}
+				}]
+			}]`,
+			want: []*TestResult{{
+				Test:   "[It] a panics",
+				Status: TestStatusFailure,
+				Output: "[PANICKED] Test Panicked\nruntime error: index out of range\n" +
+					"\nIn [It] panics\nAt step: indexing\n",
+				Summary:   "Test Panicked\nruntime error: index out of range",
+				Suite:     "suite",
+				ClassName: "suite",
+				File:      "artifacts/report.json",
+			}},
+		},
+		{
+			name: "timed out spec",
+			report: `[{
+				"SuiteDescription": "suite",
+				"SpecReports": [{
+					"LeafNodeType": "It",
+					"LeafNodeText": "waits",
+					"State": "timedout",
+					"Failure": {"Message": "A suite timeout occurred"},
+					"ProgressReports": [{"Message": "still waiting"}]
+				}]
+			}]`,
+			want: []*TestResult{{
+				Test:   "[It] waits",
+				Status: TestStatusFailure,
+				Output: "[TIMEDOUT] A suite timeout occurred\n" +
+					"\nProgress Report\nstill waiting\n",
+				Summary:   "A suite timeout occurred",
+				Suite:     "suite",
+				ClassName: "suite",
+				File:      "artifacts/report.json",
+			}},
+		},
+		{
+			name: "multiple suites",
+			report: `[
+				{"SuiteDescription": "a", "SpecReports": [{"LeafNodeType": "It", "LeafNodeText": "works", "State": "passed"}]},
+				{"SuiteDescription": "b", "SpecReports": [{"LeafNodeType": "It", "LeafNodeText": "works", "State": "passed"}]}
+			]`,
+			want: []*TestResult{
+				{Test: "[It] works", Status: TestStatusSuccess, Suite: "a", ClassName: "a", File: "artifacts/report.json"},
+				{Test: "[It] works", Status: TestStatusSuccess, Suite: "b", ClassName: "b", File: "artifacts/report.json"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseGinkgoReport("artifacts/report.json", strings.NewReader(tc.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got:")
+				for _, r := range got {
+					t.Errorf("  %#v", r)
+				}
+				t.Errorf("want:")
+				for _, r := range tc.want {
+					t.Errorf("  %#v", r)
+				}
+			}
+		})
+	}
+}
+
+func TestParseGinkgoReportInvalid(t *testing.T) {
+	if _, err := parseGinkgoReport("report.json", strings.NewReader(`{"SuiteDescription": "not a list"}`)); err == nil {
+		t.Error("expected an error for a report that is not a list of suites")
+	}
+}
@@ -0,0 +1,149 @@
+package artifacts
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// goTestEvent is an event from the output of go test -json (see go doc
+// test2json).
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type goTest struct {
+	name    string
+	pkg     string
+	action  string
+	elapsed float64
+	output  strings.Builder
+}
+
+// isFramingLine reports whether line is printed by the testing package
+// around the output of a test.
+func isFramingLine(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS", "--- FAIL", "--- SKIP"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return line == "PASS" || line == "FAIL"
+}
+
+func (t *goTest) result(file string, status TestStatus) *TestResult {
+	output := t.output.String()
+
+	var summary strings.Builder
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line != "" && !isFramingLine(line) {
+			summary.WriteString(line)
+		}
+	}
+
+	return &TestResult{
+		Test:      t.name,
+		Status:    status,
+		Output:    output,
+		Summary:   strings.TrimSpace(summary.String()),
+		Suite:     t.pkg,
+		ClassName: t.pkg,
+		File:      file,
+		Duration:  t.elapsed,
+	}
+}
+
+// parseGoTestEvents reads test results from the output of go test -json.
+// Tests are named <package>.<test>. If a package fails outside of its tests
+// (for example, it doesn't build or it times out), the package itself is
+// reported as a failed test, and its tests that didn't finish are reported as
+// failed.
+func parseGoTestEvents(file string, r io.Reader) ([]*TestResult, error) {
+	var (
+		tests    []*goTest
+		byName   = make(map[string]*goTest)
+		packages []*goTest
+		byPkg    = make(map[string]*goTest)
+	)
+	get := func(e goTestEvent) *goTest {
+		if e.Test == "" {
+			t := byPkg[e.Package]
+			if t == nil {
+				t = &goTest{name: e.Package, pkg: e.Package}
+				byPkg[e.Package] = t
+				packages = append(packages, t)
+			}
+			return t
+		}
+		name := e.Package + "." + e.Test
+		t := byName[name]
+		if t == nil {
+			t = &goTest{name: name, pkg: e.Package}
+			byName[name] = t
+			tests = append(tests, t)
+		}
+		return t
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var e goTestEvent
+			// go test prints build errors and other messages as plain text.
+			if jsonErr := json.Unmarshal(line, &e); jsonErr == nil && e.Package != "" {
+				t := get(e)
+				switch e.Action {
+				case "output":
+					t.output.WriteString(e.Output)
+				case "pass", "fail", "skip":
+					t.action = e.Action
+					t.elapsed = e.Elapsed
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	failedPkgs := make(map[string]bool)
+	for _, p := range packages {
+		if p.action == "fail" {
+			failedPkgs[p.pkg] = true
+		}
+	}
+
+	var results []*TestResult
+	pkgsWithFailedTests := make(map[string]bool)
+	for _, t := range tests {
+		switch t.action {
+		case "pass":
+			results = append(results, t.result(file, TestStatusSuccess))
+		case "skip":
+			results = append(results, t.result(file, TestStatusSkipped))
+		case "fail":
+			results = append(results, t.result(file, TestStatusFailure))
+			pkgsWithFailedTests[t.pkg] = true
+		default:
+			if failedPkgs[t.pkg] {
+				results = append(results, t.result(file, TestStatusFailure))
+				pkgsWithFailedTests[t.pkg] = true
+			}
+		}
+	}
+	for _, p := range packages {
+		if failedPkgs[p.pkg] && !pkgsWithFailedTests[p.pkg] {
+			results = append(results, p.result(file, TestStatusFailure))
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,178 @@
+package artifacts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGoTestEvents(t *testing.T) {
+	testCases := []struct {
+		name   string
+		events []string
+		// noTrailingNewline strips the newline after the last event, as in
+		// truncated files.
+		noTrailingNewline bool
+		want              []*TestResult
+	}{
+		{
+			name:   "no events",
+			events: nil,
+			want:   nil,
+		},
+		{
+			name: "passed and skipped tests",
+			events: []string{
+				`{"Action":"run","Package":"example.com/a","Test":"TestOK"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestOK","Output":"--- PASS: TestOK (0.50s)\n"}`,
+				`{"Action":"pass","Package":"example.com/a","Test":"TestOK","Elapsed":0.5}`,
+				`{"Action":"run","Package":"example.com/a","Test":"TestSkip"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestSkip","Output":"    a_test.go:20: not today\n"}`,
+				`{"Action":"skip","Package":"example.com/a","Test":"TestSkip"}`,
+				`{"Action":"pass","Package":"example.com/a","Elapsed":0.6}`,
+			},
+			want: []*TestResult{
+				{
+					Test:      "example.com/a.TestOK",
+					Status:    TestStatusSuccess,
+					Output:    "=== RUN   TestOK\n--- PASS: TestOK (0.50s)\n",
+					Suite:     "example.com/a",
+					ClassName: "example.com/a",
+					File:      "artifacts/go-test.json",
+					Duration:  0.5,
+				},
+				{
+					Test:      "example.com/a.TestSkip",
+					Status:    TestStatusSkipped,
+					Output:    "    a_test.go:20: not today\n",
+					Summary:   "a_test.go:20: not today",
+					Suite:     "example.com/a",
+					ClassName: "example.com/a",
+					File:      "artifacts/go-test.json",
+				},
+			},
+		},
+		{
+			name: "failed subtest",
+			events: []string{
+				`{"Action":"run","Package":"example.com/a","Test":"TestBad"}`,
+				`{"Action":"run","Package":"example.com/a","Test":"TestBad/sub"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestBad/sub","Output":"=== RUN   TestBad/sub\n"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestBad/sub","Output":"    a_test.go:12: got 1, want 2\n"}`,
+				`{"Action":"output","Package":"example.com/a","Test":"TestBad/sub","Output":"    --- FAIL: TestBad/sub (0.00s)\n"}`,
+				`{"Action":"fail","Package":"example.com/a","Test":"TestBad/sub"}`,
+				`{"Action":"fail","Package":"example.com/a","Test":"TestBad","Elapsed":0.1}`,
+				`{"Action":"output","Package":"example.com/a","Output":"FAIL\n"}`,
+				`{"Action":"fail","Package":"example.com/a","Elapsed":0.2}`,
+			},
+			want: []*TestResult{
+				{
+					Test:      "example.com/a.TestBad",
+					Status:    TestStatusFailure,
+					Suite:     "example.com/a",
+					ClassName: "example.com/a",
+					File:      "artifacts/go-test.json",
+					Duration:  0.1,
+				},
+				{
+					Test:      "example.com/a.TestBad/sub",
+					Status:    TestStatusFailure,
+					Output:    "=== RUN   TestBad/sub\n    a_test.go:12: got 1, want 2\n    --- FAIL: TestBad/sub (0.00s)\n",
+					Summary:   "a_test.go:12: got 1, want 2",
+					Suite:     "example.com/a",
+					ClassName: "example.com/a",
+					File:      "artifacts/go-test.json",
+				},
+			},
+		},
+		{
+			name: "package build failure",
+			events: []string{
+				`# example.com/b`,
+				`b.go:3:1: syntax error: non-declaration statement outside function body`,
+				`{"Action":"output","Package":"example.com/b","Output":"FAIL\texample.com/b [build failed]\n"}`,
+				`{"Action":"fail","Package":"example.com/b","Elapsed":0}`,
+			},
+			want: []*TestResult{{
+				Test:      "example.com/b",
+				Status:    TestStatusFailure,
+				Output:    "FAIL\texample.com/b [build failed]\n",
+				Summary:   "FAIL\texample.com/b [build failed]",
+				Suite:     "example.com/b",
+				ClassName: "example.com/b",
+				File:      "artifacts/go-test.json",
+			}},
+		},
+		{
+			name: "package timeout",
+			events: []string{
+				`{"Action":"run","Package":"example.com/c","Test":"TestDone"}`,
+				`{"Action":"pass","Package":"example.com/c","Test":"TestDone","Elapsed":1}`,
+				`{"Action":"run","Package":"example.com/c","Test":"TestHang"}`,
+				`{"Action":"output","Package":"example.com/c","Test":"TestHang","Output":"=== RUN   TestHang\n"}`,
+				`{"Action":"output","Package":"example.com/c","Output":"panic: test timed out after 10m0s\n"}`,
+				`{"Action":"fail","Package":"example.com/c","Elapsed":600}`,
+			},
+			want: []*TestResult{
+				{
+					Test:      "example.com/c.TestDone",
+					Status:    TestStatusSuccess,
+					Suite:     "example.com/c",
+					ClassName: "example.com/c",
+					File:      "artifacts/go-test.json",
+					Duration:  1,
+				},
+				{
+					Test:      "example.com/c.TestHang",
+					Status:    TestStatusFailure,
+					Output:    "=== RUN   TestHang\n",
+					Suite:     "example.com/c",
+					ClassName: "example.com/c",
+					File:      "artifacts/go-test.json",
+				},
+			},
+		},
+		{
+			name: "no trailing newline",
+			events: []string{
+				`{"Action":"run","Package":"example.com/a","Test":"TestOK"}`,
+				`{"Action":"pass","Package":"example.com/a","Test":"TestOK","Elapsed":0.5}`,
+			},
+			noTrailingNewline: true,
+			want: []*TestResult{{
+				Test:      "example.com/a.TestOK",
+				Status:    TestStatusSuccess,
+				Suite:     "example.com/a",
+				ClassName: "example.com/a",
+				File:      "artifacts/go-test.json",
+				Duration:  0.5,
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var input string
+			for _, e := range tc.events {
+				input += e + "\n"
+			}
+			if tc.noTrailingNewline {
+				input = strings.TrimSuffix(input, "\n")
+			}
+			got, err := parseGoTestEvents("artifacts/go-test.json", strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got:")
+				for _, r := range got {
+					t.Errorf("  %#v", r)
+				}
+				t.Errorf("want:")
+				for _, r := range tc.want {
+					t.Errorf("  %#v", r)
+				}
+			}
+		})
+	}
+}
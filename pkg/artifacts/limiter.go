@@ -0,0 +1,329 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Limits is a request budget for a store.
+type Limits struct {
+	// QPS is the maximum rate of requests. Zero means no limit.
+	QPS float64
+
+	// MaxConcurrent is the maximum number of requests in flight. Objects
+	// that are being downloaded count as requests until they are closed.
+	// Zero means no limit.
+	MaxConcurrent int
+
+	// MaxRetries is the number of times a request is retried after it was
+	// throttled or failed with a transient error.
+	MaxRetries int
+}
+
+// OperationStats are counters for one operation of a store.
+type OperationStats struct {
+	Calls     int64 // calls of the operation
+	Retries   int64 // retried attempts
+	Throttled int64 // attempts that were rejected with 429 Too Many Requests
+	Failures  int64 // calls that returned an error other than ErrNotFound
+}
+
+type operationCounters struct {
+	calls, retries, throttled, failures int64
+}
+
+func (c *operationCounters) stats() OperationStats {
+	return OperationStats{
+		Calls:     atomic.LoadInt64(&c.calls),
+		Retries:   atomic.LoadInt64(&c.retries),
+		Throttled: atomic.LoadInt64(&c.throttled),
+		Failures:  atomic.LoadInt64(&c.failures),
+	}
+}
+
+// limiter is a token bucket without bursts combined with a semaphore.
+type limiter struct {
+	interval time.Duration
+	sem      chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newLimiter(limits Limits) *limiter {
+	l := &limiter{}
+	if limits.QPS > 0 {
+		l.interval = time.Duration(float64(time.Second) / limits.QPS)
+	}
+	if limits.MaxConcurrent > 0 {
+		l.sem = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return l
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// acquire waits until a request can be sent. The returned function should be
+// called when the request is finished.
+func (l *limiter) acquire(ctx context.Context) (release func(), err error) {
+	if l.sem != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case l.sem <- struct{}{}:
+		}
+	}
+	release = func() {
+		if l.sem != nil {
+			<-l.sem
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// statusCode returns the HTTP status code of a failed request, or 0 if err
+// doesn't have one.
+func statusCode(err error) int {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code
+	}
+	var herr httpStatusError
+	if errors.As(err, &herr) {
+		return herr.statusCode
+	}
+	return 0
+}
+
+// isTransient reports whether a request that failed with err may succeed if
+// it is retried.
+func isTransient(err error) bool {
+	if code := statusCode(err); code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500 {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// backoff returns a random delay before the retry number attempt.
+func backoff(attempt int) time.Duration {
+	d := minBackoff << uint(attempt)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+type limitedStore struct {
+	store      Store
+	limiter    *limiter
+	maxRetries int
+
+	listDir, listFiles, open operationCounters
+}
+
+// NewLimitedStore returns a store that sends requests to store within the
+// budget limits and retries requests that were throttled or failed with a
+// transient error using exponential backoff with jitter.
+func NewLimitedStore(store Store, limits Limits) Store {
+	return &limitedStore{
+		store:      store,
+		limiter:    newLimiter(limits),
+		maxRetries: limits.MaxRetries,
+	}
+}
+
+// do calls f until it succeeds, fails with a permanent error, or runs out of
+// retries. If f succeeds, the release function is returned and the caller is
+// responsible for calling it.
+func (s *limitedStore) do(ctx context.Context, counters *operationCounters, f func() error) (release func(), err error) {
+	atomic.AddInt64(&counters.calls, 1)
+	for attempt := 0; ; attempt++ {
+		release, err = s.limiter.acquire(ctx)
+		if err != nil {
+			break
+		}
+
+		err = f()
+		if err == nil {
+			return release, nil
+		}
+		release()
+
+		if statusCode(err) == http.StatusTooManyRequests {
+			atomic.AddInt64(&counters.throttled, 1)
+		}
+		if attempt >= s.maxRetries || !isTransient(err) || ctx.Err() != nil {
+			break
+		}
+
+		delay := backoff(attempt)
+		klog.V(3).Infof("Retrying in %s: %s", delay, err)
+		atomic.AddInt64(&counters.retries, 1)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			atomic.AddInt64(&counters.failures, 1)
+			return nil, err
+		case <-t.C:
+		}
+	}
+	if !IsNotFound(err) {
+		atomic.AddInt64(&counters.failures, 1)
+	}
+	return nil, err
+}
+
+func (s *limitedStore) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	release, err := s.do(ctx, &s.listDir, func() error {
+		dirs, files, err = s.store.ListDir(ctx, bucket, prefix, startOffset)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	release()
+	return dirs, files, nil
+}
+
+func (s *limitedStore) ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
+	release, err := s.do(ctx, &s.listFiles, func() error {
+		files, err = s.store.ListFiles(ctx, bucket, prefix)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return files, nil
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+func (s *limitedStore) Open(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	release, err := s.do(ctx, &s.open, func() error {
+		var err error
+		r, err = s.store.Open(ctx, bucket, object)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &releaseOnClose{
+		ReadCloser: r,
+		release:    release,
+	}, nil
+}
+
+func (s *limitedStore) OpenTail(ctx context.Context, bucket string, object string, n int64) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	release, err := s.do(ctx, &s.open, func() error {
+		var err error
+		r, err = s.store.OpenTail(ctx, bucket, object, n)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &releaseOnClose{
+		ReadCloser: r,
+		release:    release,
+	}, nil
+}
+
+// Stats returns counters for the operations of the store.
+func (s *limitedStore) Stats() map[string]OperationStats {
+	return map[string]OperationStats{
+		"ListDir":   s.listDir.stats(),
+		"ListFiles": s.listFiles.stats(),
+		"Open":      s.open.stats(),
+	}
+}
+
+// LogStats logs counters of requests to the stores that are wrapped by
+// NewLimitedStore.
+func (c *Client) LogStats() {
+	var schemes []string
+	for scheme := range c.stores {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	for _, scheme := range schemes {
+		s, ok := c.stores[scheme].(*limitedStore)
+		if !ok {
+			continue
+		}
+		stats := s.Stats()
+		for _, op := range []string{"ListDir", "ListFiles", "Open"} {
+			st := stats[op]
+			if st.Calls == 0 {
+				continue
+			}
+			klog.V(1).Infof("%s %s: %d calls, %d retries, %d throttled, %d failed", scheme, op, st.Calls, st.Retries, st.Throttled, st.Failures)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package artifacts
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmage/triage/pkg/types"
+)
+
+// parseRefs parses refs of the repository orgRepo from started.json. The refs
+// string consists of base_ref:base_sha followed by pull:pull_sha for each pull
+// request.
+func parseRefs(orgRepo, refs string) types.Refs {
+	var r types.Refs
+	if parts := strings.SplitN(orgRepo, "/", 2); len(parts) == 2 {
+		r.Org, r.Repo = parts[0], parts[1]
+	} else {
+		r.Repo = orgRepo
+	}
+
+	parts := strings.Split(refs, ",")
+	base := strings.SplitN(parts[0], ":", 2)
+	r.BaseRef = base[0]
+	if len(base) == 2 {
+		r.BaseSHA = base[1]
+	}
+	for _, p := range parts[1:] {
+		fields := strings.Split(p, ":")
+		number, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		pull := types.Pull{Number: number}
+		if len(fields) > 1 {
+			pull.SHA = fields[1]
+		}
+		r.Pulls = append(r.Pulls, pull)
+	}
+	return r
+}
+
+// refsFromStarted returns refs from started.json. Repositories with pull
+// requests go first.
+func refsFromStarted(started StartedJson) []types.Refs {
+	var orgRepos []string
+	for orgRepo := range started.Repos {
+		orgRepos = append(orgRepos, orgRepo)
+	}
+	sort.Strings(orgRepos)
+
+	var refs []types.Refs
+	for _, orgRepo := range orgRepos {
+		refs = append(refs, parseRefs(orgRepo, started.Repos[orgRepo]))
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		return len(refs[i].Pulls) > 0 && len(refs[j].Pulls) == 0
+	})
+	return refs
+}
+
+// SetBuildMetadata fills the metadata of build, including the tested
+// repository, pull request and commits, from started.json and, if it is
+// available, prowjob.json.
+func SetBuildMetadata(build *types.Build, started StartedJson, prowJob *ProwJobJson) {
+	m := types.BuildMetadata{
+		RepoVersion: started.RepoVersion,
+		RepoCommit:  started.RepoCommit,
+		Node:        started.Node,
+		Metadata:    started.Metadata,
+	}
+	if prowJob != nil {
+		m.Type = prowJob.Spec.Type
+		m.ProwJobURL = prowJob.Status.URL
+		if prowJob.Spec.Refs != nil {
+			m.Refs = append(m.Refs, *prowJob.Spec.Refs)
+		}
+		m.Refs = append(m.Refs, prowJob.Spec.ExtraRefs...)
+	}
+	if len(m.Refs) == 0 {
+		m.Refs = refsFromStarted(started)
+	}
+	build.Metadata = m
+
+	if build.PullNumber == 0 && started.Pull != "" {
+		if n, err := strconv.Atoi(started.Pull); err == nil {
+			build.PullNumber = n
+		}
+	}
+
+	for _, refs := range m.Refs {
+		var pull *types.Pull
+		for i := range refs.Pulls {
+			if build.PullNumber == 0 || refs.Pulls[i].Number == build.PullNumber {
+				pull = &refs.Pulls[i]
+				break
+			}
+		}
+		if pull == nil && build.PullNumber != 0 {
+			continue
+		}
+
+		build.Org, build.Repo = refs.Org, refs.Repo
+		build.BaseSHA = refs.BaseSHA
+		if pull != nil {
+			build.PullNumber = pull.Number
+			build.PullSHA = pull.SHA
+		}
+		break
+	}
+}
@@ -0,0 +1,146 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/types"
+	"github.com/spf13/pflag"
+	"google.golang.org/api/option"
+)
+
+// Options configures the artifact stores that are available to commands.
+//
+// GCS buckets are accessed anonymously unless they have credentials in
+// GCSCredentialsConfig. Credentials for S3-compatible storages are read from
+// the environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+type Options struct {
+	FileRoot             string
+	S3Endpoint           string
+	S3Region             string
+	GCSWebURL            string
+	GCSCredentialsConfig string
+
+	// ResultsConfig is a file that declares which files of builds contain
+	// test results. Only junit files are read if it is empty.
+	ResultsConfig string
+
+	// Limits are applied to each remote store (gs, s3, gcsweb).
+	Limits Limits
+}
+
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.GCSCredentialsConfig, "gcs_credentials_config", "", "path to the config with credentials for private GCS buckets")
+	flags.StringVar(&o.ResultsConfig, "results_config", "", "YAML file that declares which files of builds of each job contain test results")
+	flags.StringVar(&o.FileRoot, "file_root", ".", "directory with buckets for file:// locations")
+	flags.StringVar(&o.S3Endpoint, "s3_endpoint", "https://s3.amazonaws.com", "endpoint of the S3-compatible storage for s3:// locations")
+	flags.StringVar(&o.S3Region, "s3_region", "us-east-1", "region of the S3-compatible storage for s3:// locations")
+	flags.StringVar(&o.GCSWebURL, "gcsweb_url", "", "base URL of gcsweb or an HTTP directory listing for gcsweb:// locations (e.g. https://gcsweb.example.com/gcs/)")
+	flags.Float64Var(&o.Limits.QPS, "storage_qps", 50, "maximum number of requests per second to each remote artifact store, 0 for no limit")
+	flags.IntVar(&o.Limits.MaxConcurrent, "storage_max_concurrent", 20, "maximum number of concurrent requests to each remote artifact store, 0 for no limit")
+	flags.IntVar(&o.Limits.MaxRetries, "storage_retries", 5, "number of retries for throttled and failed requests to remote artifact stores")
+}
+
+func (o *Options) newGCSStore(ctx context.Context) (Store, error) {
+	var cfg config.GCSCredentialsConfig
+	if o.GCSCredentialsConfig != "" {
+		c, err := config.LoadGCSCredentialsConfigFromFile(o.GCSCredentialsConfig)
+		if err != nil {
+			return nil, err
+		}
+		cfg = *c
+	}
+
+	// Buckets with the same credentials share a client.
+	clients := make(map[config.GCSBucketCredentials]*storage.Client)
+	newClient := func(creds config.GCSBucketCredentials) (*storage.Client, error) {
+		creds.Bucket = ""
+		if client, ok := clients[creds]; ok {
+			return client, nil
+		}
+		var opts []option.ClientOption
+		if creds.Anonymous {
+			opts = append(opts, option.WithoutAuthentication())
+		} else {
+			opts = append(opts, option.WithScopes(storage.ScopeReadOnly))
+			if creds.CredentialsFile != "" {
+				opts = append(opts, option.WithCredentialsFile(creds.CredentialsFile))
+			}
+		}
+		client, err := storage.NewClient(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		clients[creds] = client
+		return client, nil
+	}
+
+	defaultClient, err := newClient(config.GCSBucketCredentials{Anonymous: true})
+	if err != nil {
+		return nil, err
+	}
+	bucketClients := make(map[string]*storage.Client)
+	for _, creds := range cfg.Buckets {
+		if creds.Bucket == "" {
+			return nil, fmt.Errorf("%s: bucket is not set", o.GCSCredentialsConfig)
+		}
+		if creds.Anonymous && creds.CredentialsFile != "" {
+			return nil, fmt.Errorf("%s: bucket %s: credentials_file cannot be used for anonymous access", o.GCSCredentialsConfig, creds.Bucket)
+		}
+		client, err := newClient(creds)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create GCS client for bucket %s: %w", creds.Bucket, err)
+		}
+		if creds.Bucket == "*" {
+			defaultClient = client
+		} else {
+			bucketClients[creds.Bucket] = client
+		}
+	}
+
+	return NewGCSStoreWithBucketClients(defaultClient, bucketClients), nil
+}
+
+// NewClient creates a client with all configured stores.
+func (o *Options) NewClient(ctx context.Context) (*Client, error) {
+	resultFiles, err := NewResultFilesFromFile(o.ResultsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	gcsStore, err := o.newGCSStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Store, err := NewS3Store(o.S3Endpoint, o.S3Region, S3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := map[string]Store{
+		types.SchemeGCS:  NewLimitedStore(gcsStore, o.Limits),
+		types.SchemeFile: NewFileStore(o.FileRoot),
+		types.SchemeS3:   NewLimitedStore(s3Store, o.Limits),
+	}
+
+	if o.GCSWebURL != "" {
+		gcswebStore, err := NewGCSWebStore(o.GCSWebURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		stores[types.SchemeGCSWeb] = NewLimitedStore(gcswebStore, o.Limits)
+	}
+
+	client := NewClient(stores)
+	client.SetResultFiles(resultFiles)
+	return client, nil
+}
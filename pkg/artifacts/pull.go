@@ -0,0 +1,88 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/dmage/triage/pkg/types"
+)
+
+// ResolveBuild updates the location of build if it is a link (see
+// types.Build.IsLink). The scheme of the build is preserved, so mirrors of
+// GCS buckets can be used with links that point to gs:// locations.
+func (c *Client) ResolveBuild(ctx context.Context, build *types.Build) error {
+	if !build.IsLink() {
+		return nil
+	}
+
+	store, err := c.storeFor(build.Scheme)
+	if err != nil {
+		return err
+	}
+
+	f, err := store.Open(ctx, build.GCSBucket, build.GCSPrefix)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", build.URL(), err)
+	}
+
+	target := strings.TrimSpace(string(buf))
+	_, bucket, prefix, err := ParseLocation(target)
+	if err != nil {
+		return fmt.Errorf("invalid link %s: %w", build.URL(), err)
+	}
+
+	build.GCSBucket = bucket
+	build.GCSPrefix = prefix
+	SetPullInfoFromPath(build)
+	return nil
+}
+
+// SetPullInfoFromPath sets the pull request number (and the repository, if
+// possible) for builds from pr-logs/pull/[<org_repo>/]<pull>/<job>/<build-id>/.
+func SetPullInfoFromPath(build *types.Build) {
+	const pullPrefix = "pr-logs/pull/"
+
+	idx := strings.Index(build.GCSPrefix, pullPrefix)
+	if idx == -1 || (idx != 0 && build.GCSPrefix[idx-1] != '/') {
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(build.GCSPrefix[idx+len(pullPrefix):], "/"), "/")
+
+	var segment, pull string
+	switch len(parts) {
+	case 3:
+		pull = parts[0]
+	case 4:
+		segment, pull = parts[0], parts[1]
+	default:
+		return
+	}
+
+	pullNumber, err := strconv.Atoi(pull)
+	if err != nil {
+		// pr-logs/pull/batch/
+		return
+	}
+	if build.PullNumber == 0 {
+		build.PullNumber = pullNumber
+	}
+
+	if build.Repo == "" && segment != "" {
+		// GitHub organizations cannot have underscores in their names.
+		if orgRepo := strings.SplitN(segment, "_", 2); len(orgRepo) == 2 {
+			build.Org, build.Repo = orgRepo[0], orgRepo[1]
+		} else {
+			build.Repo = segment
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
+	"github.com/dmage/triage/pkg/config"
+)
+
+// Formats of files with test results.
+const (
+	FormatJUnit  = "junit"
+	FormatGinkgo = "ginkgo"
+	FormatGoTest = "gotest"
+)
+
+// parser reads test results from r. file is the name of the file relative to
+// the build directory.
+type parser func(file string, r io.Reader) ([]*TestResult, error)
+
+var parsers = map[string]parser{
+	FormatJUnit:  parseJUnit,
+	FormatGinkgo: parseGinkgoReport,
+	FormatGoTest: parseGoTestEvents,
+}
+
+func parseJUnit(file string, r io.Reader) ([]*TestResult, error) {
+	suites, err := junit.ParseStream(r)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeSuites(file, suites.Suites), nil
+}
+
+type resultFile struct {
+	pattern *regexp.Regexp
+	parse   parser
+}
+
+type jobResults struct {
+	job   *regexp.Regexp
+	files []resultFile
+}
+
+// ResultFiles selects files with test results for builds of jobs.
+type ResultFiles struct {
+	jobs []jobResults
+}
+
+// defaultResultFiles are used for jobs that don't have results configured.
+var defaultResultFiles = []resultFile{
+	{pattern: junitObject, parse: parseJUnit},
+}
+
+func NewResultFiles(cfg *config.ResultsConfig) (*ResultFiles, error) {
+	rf := &ResultFiles{}
+	for i, j := range cfg.Jobs {
+		job, err := regexp.Compile(j.Job)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job pattern in entry %d: %w", i+1, err)
+		}
+		var files []resultFile
+		for _, f := range j.Files {
+			pattern, err := regexp.Compile(f.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern in entry %d: %w", i+1, err)
+			}
+			parse, ok := parsers[f.Format]
+			if !ok {
+				return nil, fmt.Errorf("unknown format %q in entry %d", f.Format, i+1)
+			}
+			files = append(files, resultFile{
+				pattern: pattern,
+				parse:   parse,
+			})
+		}
+		rf.jobs = append(rf.jobs, jobResults{
+			job:   job,
+			files: files,
+		})
+	}
+	return rf, nil
+}
+
+// NewResultFilesFromFile returns result files from the config file path, or
+// the default junit files if path is empty.
+func NewResultFilesFromFile(path string) (*ResultFiles, error) {
+	if path == "" {
+		return &ResultFiles{}, nil
+	}
+	cfg, err := config.LoadResultsConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load results config from %s: %w", path, err)
+	}
+	rf, err := NewResultFiles(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rf, nil
+}
+
+// parserFor returns the parser for the object of a build of job, or nil if
+// the object doesn't have test results.
+func (rf *ResultFiles) parserFor(job, objectName string) parser {
+	files := defaultResultFiles
+	for _, j := range rf.jobs {
+		if j.job.MatchString(job) {
+			files = j.files
+			break
+		}
+	}
+	for _, f := range files {
+		if f.pattern.MatchString(objectName) {
+			return f.parse
+		}
+	}
+	return nil
+}
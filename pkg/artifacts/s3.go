@@ -0,0 +1,300 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Credentials are static credentials for S3-compatible object storages.
+// Requests are sent unsigned if AccessKeyID is empty.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+type s3Store struct {
+	endpoint    *url.URL
+	region      string
+	credentials S3Credentials
+	httpClient  *http.Client
+}
+
+// NewS3Store returns a store that reads artifacts from an S3-compatible
+// object storage (AWS S3, MinIO, Ceph RGW, ...). Buckets are addressed using
+// path-style URLs, i.e. <endpoint>/<bucket>/<object>.
+func NewS3Store(endpoint, region string, credentials S3Credentials, httpClient *http.Client) (Store, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: scheme should be http or https", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &s3Store{
+		endpoint:    u,
+		region:      region,
+		credentials: credentials,
+		httpClient:  httpClient,
+	}, nil
+}
+
+// s3Escape escapes s as required by AWS Signature Version 4: every byte
+// except unreserved characters is percent-encoded.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (s *s3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": emptyPayloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if s.credentials.SessionToken != "" {
+		headers["x-amz-security-token"] = s.credentials.SessionToken
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.credentials.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func (s *s3Store) do(ctx context.Context, bucket, object string, query url.Values, header http.Header) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + bucket
+	u.RawPath = s3Escape(u.Path, true)
+	if object != "" {
+		u.Path += "/" + object
+		u.RawPath += "/" + s3Escape(object, true)
+	}
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.credentials.AccessKeyID != "" {
+		s.sign(req, time.Now())
+	}
+
+	return s.httpClient.Do(req)
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+func (s *s3Store) list(ctx context.Context, bucket, prefix, delimiter, startAfter string) (dirs []string, files []string, err error) {
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if startAfter != "" {
+			query.Set("start-after", startAfter)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := s.do(ctx, bucket, "", query, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := newHTTPStatusError(resp)
+			resp.Body.Close()
+			return nil, nil, err
+		}
+
+		var result s3ListBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode list response: %w", err)
+		}
+
+		for _, p := range result.CommonPrefixes {
+			dirs = append(dirs, p.Prefix)
+		}
+		for _, c := range result.Contents {
+			files = append(files, c.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	return dirs, files, nil
+}
+
+func (s *s3Store) ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error) {
+	klog.V(4).Infof("Listing s3://%s/%s...", bucket, prefix)
+
+	// start-after is exclusive, so an object named exactly startOffset is
+	// omitted. Offsets are build directories without the trailing slash, so
+	// they are not names of objects.
+	dirs, files, err = s.list(ctx, bucket, prefix, "/", startOffset)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list objects in s3://%s/%s: %w", bucket, prefix, err)
+	}
+	return dirs, files, nil
+}
+
+func (s *s3Store) ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error) {
+	klog.V(4).Infof("Listing recursively s3://%s/%s...", bucket, prefix)
+
+	_, files, err = s.list(ctx, bucket, prefix, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all objects in s3://%s/%s: %w", bucket, prefix, err)
+	}
+	return files, nil
+}
+
+func (s *s3Store) Open(ctx context.Context, bucket string, object string) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading s3://%s/%s...", bucket, object)
+
+	resp, err := s.do(ctx, bucket, object, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := newHTTPStatusError(resp)
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3Store) OpenTail(ctx context.Context, bucket string, object string, n int64) (io.ReadCloser, error) {
+	klog.V(4).Infof("Downloading the last %d bytes of s3://%s/%s...", n, bucket, object)
+
+	resp, err := s.do(ctx, bucket, object, nil, http.Header{"Range": {tailRange(n)}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return emptyBody(), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, ErrNotFound)
+	}
+	err = newHTTPStatusError(resp)
+	resp.Body.Close()
+	return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, object, err)
+}
@@ -0,0 +1,72 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Store provides read access to build artifacts that are laid out like a GCS
+// bucket: objects are addressed by a bucket name and a slash-separated object
+// name.
+type Store interface {
+	// ListDir returns immediate subdirectories (with a trailing slash) and
+	// files under prefix. If startOffset is not empty, entries that sort
+	// lexicographically before it are omitted.
+	ListDir(ctx context.Context, bucket, prefix, startOffset string) (dirs []string, files []string, err error)
+
+	// ListFiles returns all objects under prefix.
+	ListFiles(ctx context.Context, bucket, prefix string) (files []string, err error)
+
+	// Open opens the object for reading. If the object does not exist, the
+	// returned error wraps ErrNotFound.
+	Open(ctx context.Context, bucket, object string) (io.ReadCloser, error)
+
+	// OpenTail opens the last n bytes of the object for reading. Stores may
+	// return the whole object if the server doesn't support ranged reads. If
+	// the object does not exist, the returned error wraps ErrNotFound.
+	OpenTail(ctx context.Context, bucket, object string, n int64) (io.ReadCloser, error)
+}
+
+// tailRange returns the value of the Range header for the last n bytes of an
+// object.
+func tailRange(n int64) string {
+	return fmt.Sprintf("bytes=-%d", n)
+}
+
+// emptyBody is the body of an empty object. Servers respond with 416 Range
+// Not Satisfiable to ranged reads of empty objects.
+func emptyBody() io.ReadCloser {
+	return ioutil.NopCloser(strings.NewReader(""))
+}
+
+// httpStatusError is returned by stores that talk HTTP when the server
+// responds with an unexpected status code.
+type httpStatusError struct {
+	method     string
+	url        string
+	statusCode int
+	body       string
+}
+
+func (e httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("%s %s: unexpected status code %d", e.method, e.url, e.statusCode)
+	}
+	return fmt.Sprintf("%s %s: unexpected status code %d: %s", e.method, e.url, e.statusCode, e.body)
+}
+
+// newHTTPStatusError consumes the body of a failed response and returns an
+// error that describes it.
+func newHTTPStatusError(resp *http.Response) error {
+	buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return httpStatusError{
+		method:     resp.Request.Method,
+		url:        resp.Request.URL.Redacted(),
+		statusCode: resp.StatusCode,
+		body:       strings.TrimSpace(string(buf)),
+	}
+}
@@ -0,0 +1,101 @@
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenTail(t *testing.T) {
+	objects := map[string]string{
+		"logs/job/1/build-log.txt": strings.Repeat("x", 100) + "last line\n",
+		"logs/job/2/build-log.txt": "short\n",
+		"logs/job/3/build-log.txt": "",
+	}
+
+	root := t.TempDir()
+	for name, content := range objects {
+		p := filepath.Join(root, "ci", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Header.Get("Range"))
+		// Both the S3 path-style and the gcsweb URLs are /<bucket>/<object>.
+		content, ok := objects[strings.TrimPrefix(r.URL.Path, "/ci/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	s3, err := NewS3Store(srv.URL, "us-east-1", S3Credentials{}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcsweb, err := NewGCSWebStore(srv.URL+"/", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"file":   NewFileStore(root),
+		"s3":     s3,
+		"gcsweb": gcsweb,
+	}
+
+	testCases := []struct {
+		object string
+		want   string
+	}{
+		{"logs/job/1/build-log.txt", "xxxlast line\n"},
+		{"logs/job/2/build-log.txt", "short\n"},
+		{"logs/job/3/build-log.txt", ""},
+	}
+	for name, store := range stores {
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.object, func(t *testing.T) {
+				r, err := store.OpenTail(context.Background(), "ci", tc.object, 13)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer r.Close()
+				got, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, []byte(tc.want)) {
+					t.Errorf("got %q, want %q", got, tc.want)
+				}
+			})
+		}
+
+		t.Run(name+"/not found", func(t *testing.T) {
+			_, err := store.OpenTail(context.Background(), "ci", "logs/job/4/build-log.txt", 13)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("got error %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	for _, r := range requested {
+		if r != "bytes=-13" {
+			t.Errorf("got Range header %q, want bytes=-13", r)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File is a file that is written under a temporary name in the directory of
+// its final path and is renamed to the final path by Commit.
+type File struct {
+	*os.File
+
+	path string
+	done bool
+}
+
+// Create creates a temporary file for path.
+func Create(path string) (*File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		_ = f.Close()           // Best effort cleanup
+		_ = os.Remove(f.Name()) // Best effort cleanup
+		return nil, err
+	}
+	return &File{
+		File: f,
+		path: path,
+	}, nil
+}
+
+// Commit flushes the file to disk and replaces path with it.
+func (f *File) Commit() error {
+	if f.done {
+		return os.ErrClosed
+	}
+	f.done = true
+
+	err := f.File.Sync()
+	if err == nil {
+		err = f.File.Close()
+	} else {
+		_ = f.File.Close() // Best effort cleanup
+	}
+	if err == nil {
+		err = os.Rename(f.File.Name(), f.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.File.Name()) // Best effort cleanup
+		return err
+	}
+	return nil
+}
+
+// Close discards the file if it has not been committed. It is safe to call
+// Close after Commit.
+func (f *File) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	err := f.File.Close()
+	if removeErr := os.Remove(f.File.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package builddata
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/kvcache"
+	"github.com/dmage/triage/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// dataVersion is the version of BuildData. Cached data of older versions is
+// created again, so it should be bumped when more data is collected for
+// builds. Version 1 adds job-level failures of builds without test results.
+const dataVersion = 1
+
+// BuildData is the data of a finished build that is kept in the cache.
+type BuildData struct {
+	// Version is the dataVersion of the code that created the data.
+	Version int `json:",omitempty"`
+
+	StartedJson  artifacts.StartedJson
+	FinishedJson artifacts.FinishedJson
+	TestResults  []*artifacts.TestResult
+}
+
+// CacheKey returns the key for the data of build in KVCache.
+func CacheKey(build types.Build) string {
+	return fmt.Sprintf("%s/%s", build.Job, build.BuildID)
+}
+
+// Loader gets data of builds from the cache or downloads it.
+type Loader struct {
+	db     *cache.Storage
+	client *artifacts.Client
+	cache  *kvcache.KVCache
+}
+
+func NewLoader(db *cache.Storage, client *artifacts.Client, cache *kvcache.KVCache) *Loader {
+	return &Loader{
+		db:     db,
+		client: client,
+		cache:  cache,
+	}
+}
+
+func (l *Loader) create(ctx context.Context, build types.Build) (*BuildData, error) {
+	klog.V(3).Infof("Getting data for %s @ %s...", build.Job, build.BuildID)
+
+	buildFiles, err := l.db.LoadBuildFiles(&build)
+	if cache.IsNotFound(err) {
+		buildFiles, err = l.client.GetBuildFiles(ctx, &build)
+		if err != nil {
+			return nil, err
+		}
+
+		if !buildFiles.Has("finished.json") {
+			klog.V(4).Infof("%s @ %s does not have finished.json, skipping...", build.Job, build.BuildID)
+			return nil, nil
+		}
+
+		err = l.db.SaveBuildFiles(buildFiles)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	started, err := l.client.GetStartedJson(ctx, &build)
+	if err != nil {
+		return nil, err
+	}
+
+	finished, err := l.client.GetFinishedJson(ctx, &build)
+	if artifacts.IsInvalidJSON(err) {
+		klog.V(2).Infof("%s @ %s has corrupted finished.json: %s", build.Job, build.BuildID, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	testResults, err := l.client.GetTestResults(ctx, buildFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if finished.Result == "FAILURE" && len(testResults) == 0 {
+		// Builds that failed before tests were run (e.g. setup or cluster
+		// installation failures) are reported as a job-level failure.
+		jobFailure, err := l.client.GetJobFailure(ctx, buildFiles)
+		if err != nil {
+			return nil, err
+		}
+		if jobFailure != nil {
+			testResults = append(testResults, jobFailure)
+		}
+	}
+
+	return &BuildData{
+		Version:      dataVersion,
+		StartedJson:  started,
+		FinishedJson: finished,
+		TestResults:  testResults,
+	}, nil
+}
+
+// Get returns the data of build. It returns nil if the build is not
+// finished yet.
+func (l *Loader) Get(ctx context.Context, build types.Build) (*BuildData, error) {
+	buildData := &BuildData{}
+	key := CacheKey(build)
+	err := l.cache.Load(key, buildData)
+	if err == nil && buildData.Version < dataVersion {
+		klog.V(3).Infof("Cached data for %s @ %s is outdated (version %d)", build.Job, build.BuildID, buildData.Version)
+		err = kvcache.ErrNotFound{Key: key}
+	}
+	if kvcache.IsNotFound(err) {
+		buildData, err = l.create(ctx, build)
+		if buildData == nil || err != nil {
+			return buildData, err
+		}
+
+		err = l.cache.Save(key, buildData)
+		if err != nil {
+			return buildData, err
+		}
+	}
+	return buildData, err
+}
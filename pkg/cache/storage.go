@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dmage/triage/pkg/types"
 	_ "github.com/mattn/go-sqlite3"
@@ -44,8 +45,15 @@ func (s *Storage) init() error {
 		job text,
 		build_id text,
 		started_at int,
+		scheme text NOT NULL DEFAULT 'gs',
 		gcs_bucket text,
-		gcs_prefix text
+		gcs_prefix text,
+		org text NOT NULL DEFAULT '',
+		repo text NOT NULL DEFAULT '',
+		pull_number int NOT NULL DEFAULT 0,
+		base_sha text NOT NULL DEFAULT '',
+		pull_sha text NOT NULL DEFAULT '',
+		metadata text NOT NULL DEFAULT '{}'
 	);
 	CREATE UNIQUE INDEX IF NOT EXISTS builds_idx ON builds (job, build_id);
 
@@ -56,11 +64,101 @@ func (s *Storage) init() error {
 		files text
 	);
 	CREATE UNIQUE INDEX IF NOT EXISTS build_files_idx ON build_files (job, build_id);
+
+	CREATE TABLE IF NOT EXISTS test_groups (
+		name text,
+		gcs_prefix text,
+		last_build_id text
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS test_groups_idx ON test_groups (name, gcs_prefix);
+
+	CREATE TABLE IF NOT EXISTS cluster_assignments (
+		build text,
+		test text,
+		failure text NOT NULL DEFAULT '',
+		cluster text
+	);
+
+	CREATE TABLE IF NOT EXISTS clusterings (
+		id int PRIMARY KEY,
+		last_full_clustering int
+	);
 	`
 	_, err := s.db.Exec(sqlStmt)
 	if err != nil {
 		return fmt.Errorf("%w: %s", err, sqlStmt)
 	}
+
+	// Columns that were added after the tables had been created.
+	migrations := []struct {
+		table, column, definition string
+	}{
+		{"builds", "scheme", "text NOT NULL DEFAULT 'gs'"},
+		{"builds", "org", "text NOT NULL DEFAULT ''"},
+		{"builds", "repo", "text NOT NULL DEFAULT ''"},
+		{"builds", "pull_number", "int NOT NULL DEFAULT 0"},
+		{"builds", "base_sha", "text NOT NULL DEFAULT ''"},
+		{"builds", "pull_sha", "text NOT NULL DEFAULT ''"},
+		{"builds", "metadata", "text NOT NULL DEFAULT '{}'"},
+		{"cluster_assignments", "failure", "text NOT NULL DEFAULT ''"},
+	}
+	for _, m := range migrations {
+		err := s.addColumn(m.table, m.column, m.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Indexes on the added columns can be created only after the migrations.
+	// Assignments used to be unique per build and test, which collapsed
+	// several failures of one test in one build.
+	sqlStmt = `
+	DROP INDEX IF EXISTS cluster_assignments_idx;
+	CREATE UNIQUE INDEX IF NOT EXISTS cluster_assignments_failure_idx ON cluster_assignments (build, test, failure);
+	`
+	_, err = s.db.Exec(sqlStmt)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, sqlStmt)
+	}
+
+	return nil
+}
+
+func (s *Storage) addColumn(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typ       string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	klog.V(2).Infof("Adding column %s to table %s...", column, table)
+
+	sqlStmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	_, err = s.db.Exec(sqlStmt)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, sqlStmt)
+	}
 	return nil
 }
 
@@ -68,18 +166,39 @@ func (s *Storage) Close() error {
 	return s.db.Close()
 }
 
+// buildColumns are the columns of the builds table that are read by scanBuild.
+const buildColumns = "job, build_id, scheme, gcs_bucket, gcs_prefix, org, repo, pull_number, base_sha, pull_sha, metadata"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBuild(row scanner, build *types.Build, extra ...interface{}) error {
+	var metadataBuf []byte
+	err := row.Scan(append([]interface{}{
+		&build.Job, &build.BuildID, &build.Scheme, &build.GCSBucket, &build.GCSPrefix,
+		&build.Org, &build.Repo, &build.PullNumber, &build.BaseSHA, &build.PullSHA,
+		&metadataBuf,
+	}, extra...)...)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(metadataBuf, &build.Metadata)
+	if err != nil {
+		return fmt.Errorf("unable to decode metadata for %s @ %s: %w", build.Job, build.BuildID, err)
+	}
+	return nil
+}
+
 func (s *Storage) LoadBuild(job, buildID string) (*types.Build, int64, error) {
 	klog.V(5).Infof("Loading build %s @ %s from storage...", job, buildID)
 
-	build := &types.Build{
-		Job:     job,
-		BuildID: buildID,
-	}
+	build := &types.Build{}
 	var startedAt int64
-	err := s.db.QueryRow(
-		"SELECT started_at, gcs_bucket, gcs_prefix FROM builds WHERE job = ? AND build_id = ?",
+	err := scanBuild(s.db.QueryRow(
+		"SELECT "+buildColumns+", started_at FROM builds WHERE job = ? AND build_id = ?",
 		job, buildID,
-	).Scan(&startedAt, &build.GCSBucket, &build.GCSPrefix)
+	), build, &startedAt)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -90,21 +209,23 @@ func (s *Storage) LoadBuild(job, buildID string) (*types.Build, int64, error) {
 func (s *Storage) SaveBuild(build *types.Build, startedAt int64) error {
 	klog.V(5).Infof("Saving build %s...", build)
 
-	_, err := s.db.Exec(
-		"INSERT INTO builds (job, build_id, started_at, gcs_bucket, gcs_prefix) VALUES (?, ?, ?, ?, ?)",
-		build.Job, build.BuildID, startedAt, build.GCSBucket, build.GCSPrefix,
+	metadataBuf, err := json.Marshal(build.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO builds ("+buildColumns+", started_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		build.Job, build.BuildID, build.Scheme, build.GCSBucket, build.GCSPrefix,
+		build.Org, build.Repo, build.PullNumber, build.BaseSHA, build.PullSHA,
+		string(metadataBuf), startedAt,
 	)
 	return err
 }
 
-func (s *Storage) FindBuilds(startedAt int64) ([]types.Build, error) {
-	klog.V(5).Infof("Loading builds from storage...")
-
+func (s *Storage) findBuilds(query string, args ...interface{}) ([]types.Build, error) {
 	var builds []types.Build
-	rows, err := s.db.Query(
-		"SELECT job, build_id, gcs_bucket, gcs_prefix FROM builds WHERE started_at >= ?",
-		startedAt,
-	)
+	rows, err := s.db.Query("SELECT "+buildColumns+" FROM builds WHERE "+query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,37 +233,25 @@ func (s *Storage) FindBuilds(startedAt int64) ([]types.Build, error) {
 
 	for rows.Next() {
 		var build types.Build
-		if err := rows.Scan(&build.Job, &build.BuildID, &build.GCSBucket, &build.GCSPrefix); err != nil {
+		if err := scanBuild(rows, &build); err != nil {
 			return builds, err
 		}
 		builds = append(builds, build)
 	}
 
-	return builds, nil
+	return builds, rows.Err()
 }
 
-func (s *Storage) FindOldBuilds(startedAt int64) ([]types.Build, error) {
-	klog.V(5).Infof("Loading old builds from storage...")
+func (s *Storage) FindBuilds(startedAt int64) ([]types.Build, error) {
+	klog.V(5).Infof("Loading builds from storage...")
 
-	var builds []types.Build
-	rows, err := s.db.Query(
-		"SELECT job, build_id, gcs_bucket, gcs_prefix FROM builds WHERE started_at < ?",
-		startedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return s.findBuilds("started_at >= ?", startedAt)
+}
 
-	for rows.Next() {
-		var build types.Build
-		if err := rows.Scan(&build.Job, &build.BuildID, &build.GCSBucket, &build.GCSPrefix); err != nil {
-			return builds, err
-		}
-		builds = append(builds, build)
-	}
+func (s *Storage) FindOldBuilds(startedAt int64) ([]types.Build, error) {
+	klog.V(5).Infof("Loading old builds from storage...")
 
-	return builds, nil
+	return s.findBuilds("started_at < ?", startedAt)
 }
 
 func (s *Storage) DeleteBuild(job, buildID string) error {
@@ -198,3 +307,100 @@ func (s *Storage) DeleteBuildFiles(build *types.Build) error {
 	)
 	return err
 }
+
+// LoadLastBuildID returns the ID of the build that has been saved for the test
+// group name in gcsPrefix. Builds older than it have been discovered.
+func (s *Storage) LoadLastBuildID(name, gcsPrefix string) (string, error) {
+	klog.V(5).Infof("Loading last build ID for %s (%s) from storage...", name, gcsPrefix)
+
+	var buildID string
+	err := s.db.QueryRow(
+		"SELECT last_build_id FROM test_groups WHERE name = ? AND gcs_prefix = ?",
+		name, gcsPrefix,
+	).Scan(&buildID)
+	return buildID, err
+}
+
+func (s *Storage) SaveLastBuildID(name, gcsPrefix, buildID string) error {
+	klog.V(5).Infof("Saving last build ID %s for %s (%s)...", buildID, name, gcsPrefix)
+
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO test_groups (name, gcs_prefix, last_build_id) VALUES (?, ?, ?)",
+		name, gcsPrefix, buildID,
+	)
+	return err
+}
+
+// LoadClusterAssignments returns the cluster assignments of test failures
+// that have been saved by the last clustering.
+func (s *Storage) LoadClusterAssignments() ([]types.ClusterAssignment, error) {
+	klog.V(5).Infof("Loading cluster assignments from storage...")
+
+	rows, err := s.db.Query("SELECT build, test, failure, cluster FROM cluster_assignments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []types.ClusterAssignment
+	for rows.Next() {
+		var a types.ClusterAssignment
+		if err := rows.Scan(&a.Build, &a.Test, &a.Failure, &a.Cluster); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// LoadLastFullClustering returns the time when the last clustering of all
+// failures was started.
+func (s *Storage) LoadLastFullClustering() (time.Time, error) {
+	klog.V(5).Infof("Loading the time of the last full clustering from storage...")
+
+	var startedAt int64
+	err := s.db.QueryRow("SELECT last_full_clustering FROM clusterings WHERE id = 0").Scan(&startedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(startedAt, 0), nil
+}
+
+func (s *Storage) SaveLastFullClustering(startedAt time.Time) error {
+	klog.V(5).Infof("Saving the time of the last full clustering %s...", startedAt)
+
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO clusterings (id, last_full_clustering) VALUES (0, ?)",
+		startedAt.Unix(),
+	)
+	return err
+}
+
+// SaveClusterAssignments replaces all saved cluster assignments.
+func (s *Storage) SaveClusterAssignments(assignments []types.ClusterAssignment) error {
+	klog.V(5).Infof("Saving %d cluster assignments...", len(assignments))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op after Commit
+
+	if _, err := tx.Exec("DELETE FROM cluster_assignments"); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO cluster_assignments (build, test, failure, cluster) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, a := range assignments {
+		if _, err := stmt.Exec(a.Build, a.Test, a.Failure, a.Cluster); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
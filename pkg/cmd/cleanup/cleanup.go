@@ -2,10 +2,10 @@ package cleanup
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/builddata"
 	"github.com/dmage/triage/pkg/cache"
 	"github.com/dmage/triage/pkg/kvcache"
 	"github.com/spf13/cobra"
@@ -19,6 +19,10 @@ type CleanupOptions struct {
 }
 
 func (opts *CleanupOptions) Run(ctx context.Context) error {
+	if opts.AgeLimit != 0 {
+		opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
+	}
+
 	db, err := cache.New()
 	if err != nil {
 		return err
@@ -35,7 +39,11 @@ func (opts *CleanupOptions) Run(ctx context.Context) error {
 	klog.V(2).Infof("Found %d builds", len(builds))
 
 	for _, build := range builds {
-		err := cache.Delete(fmt.Sprintf("%s/%s", build.Job, build.BuildID))
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := cache.Delete(builddata.CacheKey(build))
 		if err != nil {
 			return err
 		}
@@ -65,10 +73,6 @@ func NewCmdCleanup() *cobra.Command {
 		`),
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			if opts.AgeLimit != 0 {
-				opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
-			}
-
 			err := opts.Run(cmd.Context())
 			if err != nil {
 				klog.Exit(err)
@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/cmd/exporttriage"
+	"github.com/dmage/triage/pkg/summarize"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type ClusterOptions struct {
+	Builds              string
+	Tests               []string
+	NumWorkers          int
+	AgeLimit            time.Duration
+	NormalizationConfig string
+	Artifacts           artifacts.Options
+	Summarize           summarize.Options
+}
+
+func (opts *ClusterOptions) Run(ctx context.Context) error {
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	opts.Summarize.Assignments = db
+
+	if err := opts.Summarize.Validate(); err != nil {
+		return err
+	}
+
+	var in *summarize.Input
+	if opts.Builds != "" {
+		klog.V(2).Infof("Loading %s and %d tests files...", opts.Builds, len(opts.Tests))
+		in, err = summarize.LoadInput(opts.Builds, opts.Tests)
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(opts.Tests) != 0 {
+			return fmt.Errorf("--tests requires --builds")
+		}
+
+		in = summarize.NewInput()
+		e := &exporttriage.ExportTriageOptions{
+			NumWorkers:          opts.NumWorkers,
+			AgeLimit:            opts.AgeLimit,
+			Artifacts:           opts.Artifacts,
+			NormalizationConfig: opts.NormalizationConfig,
+			Input:               in,
+		}
+		if err := e.Run(ctx); err != nil {
+			return err
+		}
+	}
+
+	return opts.Summarize.Run(ctx, in)
+}
+
+func NewCmdCluster() *cobra.Command {
+	opts := &ClusterOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Cluster test failures",
+		Long: heredoc.Doc(`
+			Group test failures together by similarity of their failure messages
+			and render the results for the triage dashboard.
+
+			By default, builds are exported from the database in memory. For
+			compatibility with the triage binary, the input can be read from files
+			produced by export-triage using --builds and --tests.
+
+			The clusters that failures are put into are saved into the database.
+			With --incremental, failures keep their saved clusters and only new
+			failures are clustered. The input is not limited to new builds: the
+			output includes all failures, so they are still loaded and rendered.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Builds, "builds", "", "file with builds json, empty to export builds from the database")
+	cmd.Flags().StringSliceVar(&opts.Tests, "tests", nil, "files with tests json")
+	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn for export")
+	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "export only builds that are younger than the theshold")
+	cmd.Flags().StringVar(&opts.Summarize.Previous, "previous", "", "path to previous output")
+	cmd.Flags().StringVar(&opts.Summarize.Owners, "owners", "", "path to test owner SIGs file")
+	cmd.Flags().StringVar(&opts.Summarize.Output, "output", "failure_data.json", "output path")
+	cmd.Flags().StringVar(&opts.Summarize.OutputSlices, "output_slices", "", "path to slices output (must include PREFIX in template)")
+	cmd.Flags().BoolVar(&opts.Summarize.Incremental, "incremental", false, "cluster only failures that don't have saved clusters")
+	cmd.Flags().IntVar(&opts.Summarize.NumWorkers, "cluster_num_workers", summarize.DefaultNumWorkers, "number of workers for clustering")
+	cmd.Flags().StringVar(&opts.NormalizationConfig, "normalization_config", "", "YAML file with rules that normalize names of exported tests (see the test-names command)")
+	opts.Artifacts.AddFlags(cmd.Flags())
+
+	return cmd
+}
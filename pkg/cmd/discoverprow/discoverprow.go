@@ -0,0 +1,111 @@
+package discoverprow
+
+import (
+	"context"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/discovery"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type DiscoverProwOptions struct {
+	ProwConfig      string
+	JobConfigPaths  []string
+	PullLayout      bool
+	NumWorkers      int
+	AgeLimit        time.Duration
+	FullListing     bool
+	Retries         int
+	MaxFailedGroups int
+	Artifacts       artifacts.Options
+
+	createdAfter int64
+}
+
+func (opts *DiscoverProwOptions) Run(ctx context.Context) error {
+	if opts.AgeLimit != 0 {
+		opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
+	}
+
+	prowConfig := &config.ProwConfig{}
+	if opts.ProwConfig != "" {
+		var err error
+		prowConfig, err = config.LoadProwConfigFromFile(opts.ProwConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	jobConfig, err := config.LoadProwJobConfig(opts.JobConfigPaths)
+	if err != nil {
+		return err
+	}
+
+	testGroups, skipped := prowConfig.TestGroups(jobConfig, opts.PullLayout)
+	for _, job := range skipped {
+		klog.V(3).Infof("Skipping %s: the job is not decorated or does not have a GCS bucket", job)
+	}
+	klog.V(2).Infof("Found %d test groups, skipped %d jobs", len(testGroups), len(skipped))
+
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	client, err := opts.Artifacts.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.LogStats()
+
+	d := &discovery.Options{
+		NumWorkers:      opts.NumWorkers,
+		CreatedAfter:    opts.createdAfter,
+		FullListing:     opts.FullListing,
+		Retries:         opts.Retries,
+		MaxFailedGroups: opts.MaxFailedGroups,
+	}
+	return d.Run(ctx, db, client, testGroups)
+}
+
+func NewCmdDiscoverProw() *cobra.Command {
+	opts := &DiscoverProwOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "discover-prow <job-config>...",
+		Short: "Discover new builds from Prow job configuration",
+		Long: heredoc.Doc(`
+			Scan GCS locations of decorated Prow jobs to discover new builds.
+
+			Job configuration files are read from the arguments, directories are
+			scanned recursively for *.yaml files. Default decoration configs
+			(e.g. the GCS bucket) are taken from the Prow configuration file.
+		`),
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.JobConfigPaths = args
+
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.ProwConfig, "prow_config", "", "path to Prow configuration with default decoration configs")
+	cmd.Flags().BoolVar(&opts.PullLayout, "pull_layout", false, "scan pr-logs/pull/<org_repo>/ for presubmit builds instead of following links from pr-logs/directory/<job>/")
+	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn")
+	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "index only builds that are younger than the theshold")
+	cmd.Flags().BoolVar(&opts.FullListing, "full_listing", false, "list all builds instead of builds since the last discovered ones")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 2, "number of retries for test groups that failed")
+	cmd.Flags().IntVar(&opts.MaxFailedGroups, "max_failed_groups", 0, "number of failed test groups that doesn't fail the command, -1 for no limit")
+	opts.Artifacts.AddFlags(cmd.Flags())
+
+	return cmd
+}
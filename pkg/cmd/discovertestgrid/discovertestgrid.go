@@ -2,73 +2,34 @@ package discovertestgrid
 
 import (
 	"context"
-	"fmt"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/dmage/triage/pkg/artifacts"
 	"github.com/dmage/triage/pkg/cache"
 	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/discovery"
 	"github.com/spf13/cobra"
-	"google.golang.org/api/option"
 	"k8s.io/klog/v2"
 )
 
 type DiscoverTestGridOptions struct {
-	ConfigPaths []string
-	NumWorkers  int
-	AgeLimit    time.Duration
+	ConfigPaths     []string
+	NumWorkers      int
+	AgeLimit        time.Duration
+	FullListing     bool
+	Retries         int
+	MaxFailedGroups int
+	Artifacts       artifacts.Options
 
 	createdAfter int64
 }
 
-func (opts *DiscoverTestGridOptions) worker(ctx context.Context, db *cache.Storage, client *artifacts.Client, testGroups <-chan config.TestGroup) error {
-	for testGroup := range testGroups {
-		builds, err := client.FindBuilds(ctx, testGroup.Name, testGroup.GCSPrefix)
-		if err != nil {
-			return fmt.Errorf("unable to find builds for %s: %w", testGroup.Name, err)
-		}
-
-		for i, j := 0, len(builds)-1; i < j; i, j = i+1, j-1 {
-			builds[i], builds[j] = builds[j], builds[i]
-		}
-
-		for _, build := range builds {
-			_, startedAt, err := db.LoadBuild(build.Job, build.BuildID)
-			if cache.IsNotFound(err) {
-				klog.V(3).Infof("Discovered new build: %s @ %s", build.Job, build.BuildID)
-
-				started, err := client.GetStartedJson(ctx, build)
-				if artifacts.IsNotFound(err) {
-					klog.V(3).Infof("%s @ %s does not have started.json, skipping...", build.Job, build.BuildID)
-					continue
-				} else if artifacts.IsInvalidJSON(err) {
-					klog.V(3).Infof("%s @ %s has invalid started.json: %s", build.Job, build.BuildID, err)
-					continue
-				} else if err != nil {
-					return fmt.Errorf("unable to get started.json: %w", err)
-				}
-
-				err = db.SaveBuild(build, started.Timestamp)
-				if err != nil {
-					return fmt.Errorf("unable to save build: %w", err)
-				}
-
-				startedAt = started.Timestamp
-			} else if err != nil {
-				return fmt.Errorf("unable to load build from cache: %w", err)
-			}
-
-			if opts.createdAfter != 0 && startedAt < opts.createdAfter {
-				break
-			}
-		}
+func (opts *DiscoverTestGridOptions) Run(ctx context.Context) error {
+	if opts.AgeLimit != 0 {
+		opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
 	}
-	return nil
-}
 
-func (opts *DiscoverTestGridOptions) Run(ctx context.Context) error {
 	db, err := cache.New()
 	if err != nil {
 		return err
@@ -84,35 +45,20 @@ func (opts *DiscoverTestGridOptions) Run(ctx context.Context) error {
 		testGroups = append(testGroups, cfg.TestGroups...)
 	}
 
-	gcsClient, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	client, err := opts.Artifacts.NewClient(ctx)
 	if err != nil {
 		return err
 	}
-
-	client := artifacts.NewClient(gcsClient)
-
-	inputs := make(chan config.TestGroup)
-	errs := make(chan error, opts.NumWorkers)
-
-	for i := 0; i < opts.NumWorkers; i++ {
-		go func() {
-			errs <- opts.worker(ctx, db, client, inputs)
-		}()
-	}
-
-	for _, testGroup := range testGroups {
-		inputs <- testGroup
-	}
-	close(inputs)
-
-	for i := 0; i < opts.NumWorkers; i++ {
-		err := <-errs
-		if err != nil {
-			return err
-		}
+	defer client.LogStats()
+
+	d := &discovery.Options{
+		NumWorkers:      opts.NumWorkers,
+		CreatedAfter:    opts.createdAfter,
+		FullListing:     opts.FullListing,
+		Retries:         opts.Retries,
+		MaxFailedGroups: opts.MaxFailedGroups,
 	}
-
-	return nil
+	return d.Run(ctx, db, client, testGroups)
 }
 
 func NewCmdDiscoverTestGrid() *cobra.Command {
@@ -125,10 +71,6 @@ func NewCmdDiscoverTestGrid() *cobra.Command {
 			Scan GCS locations from TestGrid configuration to discover new builds.
 		`),
 		Run: func(cmd *cobra.Command, args []string) {
-			if opts.AgeLimit != 0 {
-				opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
-			}
-
 			opts.ConfigPaths = args
 
 			err := opts.Run(cmd.Context())
@@ -140,6 +82,10 @@ func NewCmdDiscoverTestGrid() *cobra.Command {
 
 	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn")
 	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "index only builds that are younger than the theshold")
+	cmd.Flags().BoolVar(&opts.FullListing, "full_listing", false, "list all builds instead of builds since the last discovered ones")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 2, "number of retries for test groups that failed")
+	cmd.Flags().IntVar(&opts.MaxFailedGroups, "max_failed_groups", 0, "number of failed test groups that doesn't fail the command, -1 for no limit")
+	opts.Artifacts.AddFlags(cmd.Flags())
 
 	return cmd
 }
@@ -0,0 +1,82 @@
+package exporttriage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dmage/triage/pkg/builddata"
+	"github.com/dmage/triage/pkg/testname"
+	"github.com/dmage/triage/pkg/types"
+)
+
+// buildExport is a build and its failures as they are saved into the builds
+// and tests files.
+type buildExport struct {
+	Build    jsonBuild     `json:"build"`
+	Failures []jsonFailure `json:"failures"`
+}
+
+// BuildExporter exports single builds, for example as soon as they are
+// finished.
+type BuildExporter struct {
+	opts *ExportTriageOptions
+}
+
+// NewBuildExporter returns an exporter that reads builds using loader.
+func NewBuildExporter(loader *builddata.Loader) (*BuildExporter, error) {
+	normalizer, err := testname.NewNormalizerFromFile("")
+	if err != nil {
+		return nil, err
+	}
+	return &BuildExporter{
+		opts: &ExportTriageOptions{
+			GroupBy:    groupByName,
+			loader:     loader,
+			normalizer: normalizer,
+		},
+	}, nil
+}
+
+// Export saves build and its failures into <dir>/<job>/<build-id>.json in
+// the formats of the builds and tests files. It returns the number of
+// failures, or -1 if the build is not finished yet.
+func (e *BuildExporter) Export(ctx context.Context, build types.Build, dir string) (int, error) {
+	jsonBuilds := make(chan jsonBuild, 1)
+	jsonFailures := make(chan jsonFailure)
+	buildSummaries := make(chan buildSummary, 1)
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(jsonFailures)
+		// Durations are not exported, so nothing is sent to jsonDurations.
+		errCh <- e.opts.handleBuild(ctx, build, jsonBuilds, jsonFailures, nil, buildSummaries)
+	}()
+
+	var export buildExport
+	for failure := range jsonFailures {
+		export.Failures = append(export.Failures, failure)
+	}
+	if err := <-errCh; err != nil {
+		return 0, err
+	}
+
+	select {
+	case export.Build = <-jsonBuilds:
+	default:
+		return -1, nil
+	}
+	if export.Failures == nil {
+		export.Failures = []jsonFailure{}
+	}
+
+	jobDir := filepath.Join(dir, build.Job)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return 0, fmt.Errorf("unable to create %s: %w", jobDir, err)
+	}
+	if err := writeJSON(filepath.Join(jobDir, build.BuildID+".json"), export); err != nil {
+		return 0, err
+	}
+	return len(export.Failures), nil
+}
@@ -1,23 +1,24 @@
 package exporttriage
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/atomicfile"
+	"github.com/dmage/triage/pkg/builddata"
 	"github.com/dmage/triage/pkg/cache"
 	"github.com/dmage/triage/pkg/kvcache"
+	"github.com/dmage/triage/pkg/summarize"
 	"github.com/dmage/triage/pkg/testname"
 	"github.com/dmage/triage/pkg/types"
 	"github.com/spf13/cobra"
-	"google.golang.org/api/option"
 	"k8s.io/klog/v2"
 )
 
@@ -29,13 +30,22 @@ type testStats struct {
 }
 
 type buildSummary struct {
-	Job       string
-	BuildID   string
-	Started   int64
-	Result    string
+	Job     string
+	BuildID string
+	Started int64
+	Result  string
+
+	// TestStats are keyed by the names under which tests are reported in
+	// summaries (see summaryName).
 	TestStats map[string]*testStats
 }
 
+// Ways to report tests in summaries.
+const (
+	groupByName = "name"
+	groupByKey  = "key"
+)
+
 type jsonTestStats struct {
 	Succeed []string
 	Failed  []string
@@ -67,9 +77,14 @@ type jsonBuild struct {
 	TestsFailed string `json:"tests_failed"`
 	Job         string `json:"job"`
 	Number      string `json:"number"`
+	PR          string `json:"pr,omitempty"`
 
 	// Additional info that is not required for triage dashboard
-	Result string `json:"result"`
+	Result   string               `json:"result"`
+	Repo     string               `json:"repo,omitempty"`
+	BaseSHA  string               `json:"base_sha,omitempty"`
+	PullSHA  string               `json:"pull_sha,omitempty"`
+	Metadata *types.BuildMetadata `json:"metadata,omitempty"`
 }
 
 type jsonFailure struct {
@@ -77,75 +92,152 @@ type jsonFailure struct {
 	Path        string `json:"build"`
 	Name        string `json:"name"`
 	FailureText string `json:"failure_text"`
+
+	// Additional info that is not required for triage dashboard
+	Suite      string            `json:"suite,omitempty"`
+	ClassName  string            `json:"classname,omitempty"`
+	File       string            `json:"file,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Labels     []string          `json:"labels,omitempty"`
+	Location   string            `json:"failure_location,omitempty"`
+}
+
+type jsonDuration struct {
+	Path     string  `json:"build"`
+	Job      string  `json:"job"`
+	Number   string  `json:"number"`
+	Started  int64   `json:"started"`
+	Name     string  `json:"name"`
+	Suite    string  `json:"suite,omitempty"`
+	File     string  `json:"file,omitempty"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
 }
 
 type ExportTriageOptions struct {
-	Builds     string
-	Tests      string
-	Summary    string
-	NumWorkers int
-	AgeLimit   time.Duration
+	Builds       string
+	Tests        string
+	Summary      string
+	FlakeSummary string
+	FlakeWindows []string
+	GroupBy      string
+	Durations    string
+	NumWorkers   int
+	AgeLimit     time.Duration
+	Artifacts    artifacts.Options
+
+	// NormalizationConfig is a file with rules that normalize test names.
+	// testname.DefaultRules are used if it is empty. Normalized names are
+	// used to group results of tests in summaries; failures keep the names
+	// from the test results.
+	NormalizationConfig string
+
+	// Input, if set, receives builds and failures for in-process clustering.
+	Input *summarize.Input
 
 	createdAfter int64
 	cache        *kvcache.KVCache
+	loader       *builddata.Loader
+	normalizer   *testname.Normalizer
+	now          time.Time
+	flakeWindows []flakeWindow
 }
 
-func (opts *ExportTriageOptions) buildsExporter(builds <-chan jsonBuild) (err error) {
-	if opts.Builds == "" {
+func (opts *ExportTriageOptions) buildsExporter(ctx context.Context, builds <-chan jsonBuild) error {
+	if opts.Builds == "" && opts.Input == nil {
 		for range builds {
 		}
 		return nil
 	}
 
-	f, err := os.Create(opts.Builds)
-	if err != nil {
-		return fmt.Errorf("unable to open %s: %w", opts.Builds, err)
-	}
-	defer func() {
-		if closeErr := f.Close(); err == nil && closeErr != nil {
-			err = closeErr
-		}
-	}()
-
 	var bs []jsonBuild
+	processed := 0
 	t := time.NewTicker(30 * time.Second)
 	for build := range builds {
-		bs = append(bs, build)
+		processed++
+		if opts.Input != nil {
+			err := opts.Input.AddBuild(summarize.JSONBuild{
+				Path:        build.Path,
+				Started:     build.Started,
+				Elapsed:     build.Elapsed,
+				TestsRun:    build.TestsRun,
+				TestsFailed: build.TestsFailed,
+				Result:      build.Result,
+				Job:         build.Job,
+				Number:      build.Number,
+				PR:          build.PR,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if opts.Builds != "" {
+			bs = append(bs, build)
+		}
 		select {
 		case <-t.C:
-			klog.V(2).Infof("Processed %d builds", len(bs))
+			klog.V(2).Infof("Processed %d builds", processed)
 		default:
 		}
 	}
 	t.Stop()
-	klog.V(2).Infof("Processed %d builds", len(bs))
+	klog.V(2).Infof("Processed %d builds", processed)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.Builds == "" {
+		return nil
+	}
+
+	f, err := atomicfile.Create(opts.Builds)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", opts.Builds, err)
+	}
+	defer f.Close()
 
 	err = json.NewEncoder(f).Encode(bs)
 	if err != nil {
 		return fmt.Errorf("unable to save builds into %s: %w", opts.Builds, err)
 	}
 
-	return nil
+	return f.Commit()
 }
 
-func (opts *ExportTriageOptions) failuresExporter(failures <-chan jsonFailure) (err error) {
-	if opts.Tests == "" {
+func (opts *ExportTriageOptions) failuresExporter(ctx context.Context, failures <-chan jsonFailure) error {
+	if opts.Tests == "" && opts.Input == nil {
 		for range failures {
 		}
 		return nil
 	}
 
-	f, err := os.Create(opts.Tests)
-	if err != nil {
-		return fmt.Errorf("unable to open %s: %w", opts.Tests, err)
-	}
-	defer func() {
-		if closeErr := f.Close(); err == nil && closeErr != nil {
-			err = closeErr
+	var f *atomicfile.File
+	if opts.Tests != "" {
+		var err error
+		f, err = atomicfile.Create(opts.Tests)
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", opts.Tests, err)
 		}
-	}()
+		defer f.Close()
+	}
 
 	for failure := range failures {
+		if opts.Input != nil {
+			err := opts.Input.AddFailure(summarize.JSONFailure{
+				Started:     failure.Started,
+				Build:       failure.Path,
+				Name:        failure.Name,
+				FailureText: failure.FailureText,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if f == nil {
+			continue
+		}
+
 		buf, err := json.Marshal(failure)
 		if err != nil {
 			return fmt.Errorf("unable to marshal failure: %w", err)
@@ -157,29 +249,83 @@ func (opts *ExportTriageOptions) failuresExporter(failures <-chan jsonFailure) (
 		}
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if f == nil {
+		return nil
+	}
+	return f.Commit()
 }
 
-func (opts *ExportTriageOptions) summaryExporter(builds <-chan buildSummary) (err error) {
-	if opts.Summary == "" {
-		for range builds {
+func (opts *ExportTriageOptions) durationsExporter(ctx context.Context, durations <-chan jsonDuration) error {
+	if opts.Durations == "" {
+		for range durations {
 		}
 		return nil
 	}
 
-	f, err := os.Create(opts.Summary)
+	f, err := atomicfile.Create(opts.Durations)
 	if err != nil {
-		return fmt.Errorf("unable to open %s: %w", opts.Summary, err)
+		return fmt.Errorf("unable to create %s: %w", opts.Durations, err)
 	}
-	defer func() {
-		if closeErr := f.Close(); err == nil && closeErr != nil {
-			err = closeErr
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for d := range durations {
+		if err := enc.Encode(d); err != nil {
+			return fmt.Errorf("unable to write duration into %s: %w", opts.Durations, err)
 		}
-	}()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to write durations into %s: %w", opts.Durations, err)
+	}
+	return f.Commit()
+}
+
+// writeJSON atomically saves v into path.
+func writeJSON(path string, v interface{}) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(v)
+	if err != nil {
+		return fmt.Errorf("unable to save %s: %w", path, err)
+	}
+
+	return f.Commit()
+}
+
+func (opts *ExportTriageOptions) summaryExporter(ctx context.Context, builds <-chan buildSummary) error {
+	if opts.Summary == "" && opts.FlakeSummary == "" {
+		for range builds {
+		}
+		return nil
+	}
 
 	summary := make(jsonSummary)
+	flakes := newFlakeSummary(opts.now, opts.flakeWindows)
 	for bs := range builds {
 		for test, stats := range bs.TestStats {
+			o := outcome(stats, bs.Result)
+
+			if opts.FlakeSummary != "" {
+				flakes.add(bs, test, o)
+			}
+			if opts.Summary == "" {
+				continue
+			}
+
 			testSummary := summary[test]
 			if testSummary == nil {
 				testSummary = make(map[string]*jsonTestStats)
@@ -192,105 +338,52 @@ func (opts *ExportTriageOptions) summaryExporter(builds <-chan buildSummary) (er
 				testSummary[bs.Job] = jobSummary
 			}
 
-			if stats.Failed > 0 || stats.Error > 0 {
-				if stats.Succeed > 0 || bs.Result == "SUCCESS" {
-					jobSummary.Flaked = append(jobSummary.Flaked, bs.BuildID)
-				} else {
-					jobSummary.Failed = append(jobSummary.Failed, bs.BuildID)
-				}
-			} else if stats.Succeed > 0 {
+			switch o {
+			case outcomeFlaked:
+				jobSummary.Flaked = append(jobSummary.Flaked, bs.BuildID)
+			case outcomeFailed:
+				jobSummary.Failed = append(jobSummary.Failed, bs.BuildID)
+			case outcomePassed:
 				jobSummary.Succeed = append(jobSummary.Succeed, bs.BuildID)
-			} else if stats.Skipped > 0 {
+			case outcomeSkipped:
 				jobSummary.Skipped = append(jobSummary.Skipped, bs.BuildID)
-			} else {
-				panic(fmt.Errorf("unexpected result: %#+v", stats))
 			}
 		}
 	}
 
-	err = json.NewEncoder(f).Encode(summary)
-	if err != nil {
-		return fmt.Errorf("unable to save summary into %s: %w", opts.Summary, err)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-type BuildData struct {
-	StartedJson  artifacts.StartedJson
-	FinishedJson artifacts.FinishedJson
-	TestResults  []*artifacts.TestResult
-}
-
-func (opts *ExportTriageOptions) createBuildData(ctx context.Context, db *cache.Storage, client *artifacts.Client, build types.Build) (*BuildData, error) {
-	klog.V(3).Infof("Getting data for %s @ %s...", build.Job, build.BuildID)
-
-	buildFiles, err := db.LoadBuildFiles(&build)
-	if cache.IsNotFound(err) {
-		buildFiles, err = client.GetBuildFiles(ctx, &build)
-		if err != nil {
-			return nil, err
-		}
-
-		if !buildFiles.Has("finished.json") {
-			klog.V(4).Infof("%s @ %s does not have finished.json, skipping...", build.Job, build.BuildID)
-			return nil, nil
-		}
-
-		err = db.SaveBuildFiles(buildFiles)
-		if err != nil {
-			return nil, err
+	if opts.Summary != "" {
+		if err := writeJSON(opts.Summary, summary); err != nil {
+			return err
 		}
-	} else if err != nil {
-		return nil, err
-	}
-
-	started, err := client.GetStartedJson(ctx, &build)
-	if err != nil {
-		return nil, err
 	}
 
-	finished, err := client.GetFinishedJson(ctx, &build)
-	if artifacts.IsInvalidJSON(err) {
-		klog.V(2).Infof("%s @ %s has corrupted finished.json: %s", build.Job, build.BuildID, err)
-	} else if err != nil {
-		return nil, err
-	}
-
-	testResults, err := client.GetTestResults(ctx, buildFiles)
-	if err != nil {
-		return nil, err
+	if opts.FlakeSummary != "" {
+		if err := writeJSON(opts.FlakeSummary, flakes.render()); err != nil {
+			return err
+		}
 	}
 
-	return &BuildData{
-		StartedJson:  started,
-		FinishedJson: finished,
-		TestResults:  testResults,
-	}, nil
+	return nil
 }
 
-func (opts *ExportTriageOptions) getBuildData(ctx context.Context, db *cache.Storage, client *artifacts.Client, build types.Build) (*BuildData, error) {
-	buildData := &BuildData{}
-	key := fmt.Sprintf("%s/%s", build.Job, build.BuildID)
-	err := opts.cache.Load(key, buildData)
-	if kvcache.IsNotFound(err) {
-		buildData, err = opts.createBuildData(ctx, db, client, build)
-		if buildData == nil || err != nil {
-			return buildData, err
-		}
-
-		err = opts.cache.Save(key, buildData)
-		if err != nil {
-			return buildData, err
-		}
+// summaryName returns the name under which r is reported in summaries.
+func (opts *ExportTriageOptions) summaryName(r *artifacts.TestResult, normalizedName string) string {
+	if opts.GroupBy == groupByKey {
+		key := r.Key()
+		key.Test = normalizedName
+		return key.String()
 	}
-	return buildData, err
+	return normalizedName
 }
 
-func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Storage, client *artifacts.Client, build types.Build, jsonBuilds chan<- jsonBuild, jsonFailures chan<- jsonFailure, buildSummaries chan<- buildSummary) error {
+func (opts *ExportTriageOptions) handleBuild(ctx context.Context, build types.Build, jsonBuilds chan<- jsonBuild, jsonFailures chan<- jsonFailure, jsonDurations chan<- jsonDuration, buildSummaries chan<- buildSummary) error {
 	klog.V(4).Infof("Analyzing %s @ %s...", build.Job, build.BuildID)
 
-	buildData, err := opts.getBuildData(ctx, db, client, build)
+	buildData, err := opts.loader.Get(ctx, build)
 	if err != nil {
 		return err
 	}
@@ -299,6 +392,10 @@ func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Stor
 	}
 
 	path := fmt.Sprintf("%s/%s", build.GCSBucket, strings.TrimSuffix(build.GCSPrefix, "/"))
+	if build.Scheme != types.SchemeGCS {
+		// Triage treats paths as GCS locations, keep other locations distinguishable.
+		path = build.Scheme + "://" + path
+	}
 
 	bs := buildSummary{
 		Job:       build.Job,
@@ -311,16 +408,44 @@ func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Stor
 	testsRun := 0
 	testsFailed := 0
 	for _, r := range buildData.TestResults {
-		normalizedName := testname.Normalize(r.Test)
-		stats := bs.TestStats[normalizedName]
-		if stats == nil {
-			stats = new(testStats)
-			bs.TestStats[normalizedName] = stats
+		normalizedName := opts.normalizer.Normalize(r.Test)
+
+		// Synthetic results (job-level failures) are exported as failures
+		// for clustering, but they are not counted as tests.
+		stats := new(testStats)
+		if !r.Synthetic {
+			name := opts.summaryName(r, normalizedName)
+			if s := bs.TestStats[name]; s != nil {
+				stats = s
+			} else {
+				bs.TestStats[name] = stats
+			}
+		}
+
+		if opts.Durations != "" && r.Duration > 0 {
+			d := jsonDuration{
+				Path:     path,
+				Job:      build.Job,
+				Number:   build.BuildID,
+				Started:  buildData.StartedJson.Timestamp,
+				Name:     normalizedName,
+				Suite:    r.Suite,
+				File:     r.File,
+				Status:   string(r.Status),
+				Duration: r.Duration,
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case jsonDurations <- d:
+			}
 		}
 
 		switch r.Status {
 		case artifacts.TestStatusSuccess:
-			testsRun++
+			if !r.Synthetic {
+				testsRun++
+			}
 			stats.Succeed++
 		case artifacts.TestStatusFailure:
 			summary := r.Summary
@@ -328,13 +453,26 @@ func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Stor
 				summary = summary[:idx]
 			}
 
-			testsRun++
-			testsFailed++
-			jsonFailures <- jsonFailure{
+			if !r.Synthetic {
+				testsRun++
+				testsFailed++
+			}
+			failure := jsonFailure{
 				Started:     fmt.Sprintf("%d", buildData.StartedJson.Timestamp),
 				Path:        path,
 				Name:        r.Test,
 				FailureText: summary,
+				Suite:       r.Suite,
+				ClassName:   r.ClassName,
+				File:        r.File,
+				Properties:  r.Properties,
+				Labels:      r.Labels,
+				Location:    r.FailureLocation,
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case jsonFailures <- failure:
 			}
 			stats.Failed++
 		case artifacts.TestStatusSkipped:
@@ -344,7 +482,7 @@ func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Stor
 		}
 	}
 
-	jsonBuilds <- jsonBuild{
+	jb := jsonBuild{
 		Path:        path,
 		Started:     fmt.Sprintf("%d", buildData.StartedJson.Timestamp),
 		Elapsed:     fmt.Sprintf("%d", buildData.FinishedJson.Timestamp-buildData.StartedJson.Timestamp),
@@ -353,16 +491,41 @@ func (opts *ExportTriageOptions) handleBuild(ctx context.Context, db *cache.Stor
 		Job:         build.Job,
 		Number:      build.BuildID,
 		Result:      buildData.FinishedJson.Result,
+		BaseSHA:     build.BaseSHA,
+		PullSHA:     build.PullSHA,
+	}
+	if build.Repo != "" {
+		jb.Repo = build.Repo
+		if build.Org != "" {
+			jb.Repo = build.Org + "/" + build.Repo
+		}
+	}
+	if !build.Metadata.IsZero() {
+		jb.Metadata = &build.Metadata
+	}
+	if build.IsPull() {
+		// The triage dashboard hides jobs with this prefix unless PR results are requested.
+		jb.Job = "pr:" + build.Job
+		jb.PR = fmt.Sprintf("%d", build.PullNumber)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case jsonBuilds <- jb:
 	}
 
-	buildSummaries <- bs
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case buildSummaries <- bs:
+	}
 
 	return nil
 }
 
-func (opts *ExportTriageOptions) worker(ctx context.Context, db *cache.Storage, client *artifacts.Client, builds <-chan types.Build, jsonBuilds chan<- jsonBuild, jsonFailures chan<- jsonFailure, buildSummaries chan<- buildSummary) error {
+func (opts *ExportTriageOptions) worker(ctx context.Context, builds <-chan types.Build, jsonBuilds chan<- jsonBuild, jsonFailures chan<- jsonFailure, jsonDurations chan<- jsonDuration, buildSummaries chan<- buildSummary) error {
 	for build := range builds {
-		if err := opts.handleBuild(ctx, db, client, build, jsonBuilds, jsonFailures, buildSummaries); err != nil {
+		if err := opts.handleBuild(ctx, build, jsonBuilds, jsonFailures, jsonDurations, buildSummaries); err != nil {
 			return err
 		}
 	}
@@ -370,18 +533,51 @@ func (opts *ExportTriageOptions) worker(ctx context.Context, db *cache.Storage,
 }
 
 func (opts *ExportTriageOptions) Run(ctx context.Context) error {
+	opts.now = time.Now()
+	if opts.AgeLimit != 0 {
+		opts.createdAfter = opts.now.Add(-opts.AgeLimit).Unix()
+	}
+
+	if opts.GroupBy == "" {
+		opts.GroupBy = groupByName
+	}
+	if opts.GroupBy != groupByName && opts.GroupBy != groupByKey {
+		return fmt.Errorf("invalid --group_by %q: should be %s or %s", opts.GroupBy, groupByName, groupByKey)
+	}
+
+	flakeWindows, err := parseFlakeWindows(opts.FlakeWindows)
+	if err != nil {
+		return err
+	}
+	if opts.FlakeSummary != "" {
+		if err := checkFlakeWindows(flakeWindows, opts.AgeLimit); err != nil {
+			return err
+		}
+	}
+	opts.flakeWindows = flakeWindows
+	if opts.cache == nil {
+		opts.cache = kvcache.NewDefaultKVCache()
+	}
+
+	normalizer, err := testname.NewNormalizerFromFile(opts.NormalizationConfig)
+	if err != nil {
+		return err
+	}
+	opts.normalizer = normalizer
+
 	db, err := cache.New()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	gcsClient, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	client, err := opts.Artifacts.NewClient(ctx)
 	if err != nil {
 		return err
 	}
+	defer client.LogStats()
 
-	client := artifacts.NewClient(gcsClient)
+	opts.loader = builddata.NewLoader(db, client, opts.cache)
 
 	builds, err := db.FindBuilds(opts.createdAfter)
 	if err != nil {
@@ -390,64 +586,78 @@ func (opts *ExportTriageOptions) Run(ctx context.Context) error {
 
 	klog.V(2).Infof("Found %d builds", len(builds))
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+		})
+		cancel()
+	}
+
 	jsonBuilds := make(chan jsonBuild)
 	jsonFailures := make(chan jsonFailure)
+	jsonDurations := make(chan jsonDuration)
 	buildSummaries := make(chan buildSummary)
 	inputs := make(chan types.Build)
-	errs := make(chan error, opts.NumWorkers)
-
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := opts.buildsExporter(jsonBuilds); err != nil {
-			klog.Exit(err)
-		}
-	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := opts.failuresExporter(jsonFailures); err != nil {
-			klog.Exit(err)
-		}
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := opts.summaryExporter(buildSummaries); err != nil {
-			klog.Exit(err)
-		}
-	}()
+	// The exporters commit their files only if the context is not canceled
+	// when their inputs are closed.
+	var exporters sync.WaitGroup
+	for _, exporter := range []func() error{
+		func() error { return opts.buildsExporter(ctx, jsonBuilds) },
+		func() error { return opts.failuresExporter(ctx, jsonFailures) },
+		func() error { return opts.durationsExporter(ctx, jsonDurations) },
+		func() error { return opts.summaryExporter(ctx, buildSummaries) },
+	} {
+		exporters.Add(1)
+		go func(exporter func() error) {
+			defer exporters.Done()
+			if err := exporter(); err != nil {
+				fail(err)
+			}
+		}(exporter)
+	}
 
+	var workers sync.WaitGroup
 	for i := 0; i < opts.NumWorkers; i++ {
+		workers.Add(1)
 		go func() {
-			errs <- opts.worker(ctx, db, client, inputs, jsonBuilds, jsonFailures, buildSummaries)
+			defer workers.Done()
+			if err := opts.worker(ctx, inputs, jsonBuilds, jsonFailures, jsonDurations, buildSummaries); err != nil {
+				fail(err)
+			}
 		}()
 	}
 
 	go func() {
+		defer close(inputs)
 		for _, build := range builds {
-			inputs <- build
+			select {
+			case <-ctx.Done():
+				return
+			case inputs <- build:
+			}
 		}
-		close(inputs)
 	}()
 
-	for i := 0; i < opts.NumWorkers; i++ {
-		err := <-errs
-		if err != nil {
-			return err
-		}
+	workers.Wait()
+	if err := ctx.Err(); err != nil {
+		fail(err)
 	}
 	close(jsonBuilds)
 	close(jsonFailures)
+	close(jsonDurations)
 	close(buildSummaries)
 
-	wg.Wait()
+	exporters.Wait()
 
-	return nil
+	return firstErr
 }
 
 func NewCmdExportTriage() *cobra.Command {
@@ -458,15 +668,36 @@ func NewCmdExportTriage() *cobra.Command {
 		Short: "Generate files for triage",
 		Long: heredoc.Doc(`
 			Generate triage_builds.json and triage_tests.json for triage.
+
+			With --durations, durations of tests from junit files are saved as
+			JSON lines.
+
+			With --flake_summary, pass, fail and flake counts and rates are saved
+			for every test and job over each of --flake_windows, together with
+			their changes compared with the previous window of the same length.
+			Tests are sorted by the number of flakes in the first window. --age
+			should be at least twice as long as the longest window.
+
+			Failures in the tests json keep the junit suite, classname, file and
+			properties of the tests. With --group_by=name, the summaries report
+			tests by their names, and all runs of a test in a build determine
+			its outcome in the build. With --group_by=key, tests are reported as
+			"<suite> | <classname> | <name>", and outcomes are determined
+			separately for each suite and classname. Runs from different junit
+			files are merged in both cases, so a failure followed by a passing
+			retry in another file is a flake.
+
+			Builds that failed without test results are reported as a failure of
+			the test "[job] build failed" (or "[job] build failed in <step>" for
+			the earliest failed step of multi-stage jobs) with the tail of the
+			build log as its failure text. Such failures are clustered, but they
+			are not counted as tests in builds and summaries.
+
+			Cached data of builds is created again when the scraper starts to
+			collect more data for builds (for example, job-level failures).
 		`),
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			if opts.AgeLimit != 0 {
-				opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
-			}
-
-			opts.cache = kvcache.NewDefaultKVCache()
-
 			err := opts.Run(cmd.Context())
 			if err != nil {
 				klog.Exit(err)
@@ -477,8 +708,14 @@ func NewCmdExportTriage() *cobra.Command {
 	cmd.Flags().StringVar(&opts.Builds, "builds", "", "file to save builds json")
 	cmd.Flags().StringVar(&opts.Tests, "tests", "", "file to save tests json")
 	cmd.Flags().StringVar(&opts.Summary, "summary", "", "file to save summary json")
+	cmd.Flags().StringVar(&opts.Durations, "durations", "", "file to save durations of tests json")
+	cmd.Flags().StringVar(&opts.FlakeSummary, "flake_summary", "", "file to save pass, fail and flake rates of tests")
+	cmd.Flags().StringSliceVar(&opts.FlakeWindows, "flake_windows", []string{"24h", "7d"}, "time windows for --flake_summary (e.g. 12h, 7d)")
+	cmd.Flags().StringVar(&opts.GroupBy, "group_by", groupByName, "how tests are reported in summaries: name or key")
 	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn")
 	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "index only builds that are younger than the theshold")
+	cmd.Flags().StringVar(&opts.NormalizationConfig, "normalization_config", "", "YAML file with rules that normalize test names (see the test-names command)")
+	opts.Artifacts.AddFlags(cmd.Flags())
 
 	return cmd
 }
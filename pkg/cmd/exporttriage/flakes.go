@@ -0,0 +1,308 @@
+package exporttriage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dmage/triage/pkg/window"
+)
+
+// Outcomes of a test in a build.
+const (
+	outcomePassed  = "passed"
+	outcomeFailed  = "failed"
+	outcomeFlaked  = "flaked"
+	outcomeSkipped = "skipped"
+)
+
+// outcome returns the outcome of a test in a build with the result
+// buildResult. A failed test is a flake if it also succeeded in the build or
+// if the build succeeded nevertheless.
+func outcome(stats *testStats, buildResult string) string {
+	if stats.Failed > 0 || stats.Error > 0 {
+		if stats.Succeed > 0 || buildResult == "SUCCESS" {
+			return outcomeFlaked
+		}
+		return outcomeFailed
+	} else if stats.Succeed > 0 {
+		return outcomePassed
+	} else if stats.Skipped > 0 {
+		return outcomeSkipped
+	}
+	panic(fmt.Errorf("unexpected result: %#+v", stats))
+}
+
+type flakeWindow struct {
+	name     string
+	duration time.Duration
+}
+
+func parseFlakeWindows(names []string) ([]flakeWindow, error) {
+	var windows []flakeWindow
+	for _, name := range names {
+		d, err := window.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, flakeWindow{name: name, duration: d})
+	}
+	return windows, nil
+}
+
+// checkFlakeWindows returns an error if builds that are younger than age don't
+// cover the previous period of each window, so its trend cannot be computed.
+// Zero age means no limit.
+func checkFlakeWindows(windows []flakeWindow, age time.Duration) error {
+	if age == 0 {
+		return nil
+	}
+	for _, w := range windows {
+		if 2*w.duration > age {
+			return fmt.Errorf("flake window %s needs builds for the last %s to compare it with the previous window, but --age is %s", w.name, 2*w.duration, age)
+		}
+	}
+	return nil
+}
+
+type outcomeCounts struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Flaked  int `json:"flaked"`
+	Skipped int `json:"skipped"`
+}
+
+func (c *outcomeCounts) add(outcome string) {
+	switch outcome {
+	case outcomePassed:
+		c.Passed++
+	case outcomeFailed:
+		c.Failed++
+	case outcomeFlaked:
+		c.Flaked++
+	case outcomeSkipped:
+		c.Skipped++
+	}
+}
+
+func (c *outcomeCounts) merge(other outcomeCounts) {
+	c.Passed += other.Passed
+	c.Failed += other.Failed
+	c.Flaked += other.Flaked
+	c.Skipped += other.Skipped
+}
+
+// runs returns the number of builds where the test ran. Skipped tests are
+// not counted.
+func (c outcomeCounts) runs() int {
+	return c.Passed + c.Failed + c.Flaked
+}
+
+// percent returns n as a percentage of total rounded to two decimal places.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*10000/float64(total)) / 100
+}
+
+type jsonRates struct {
+	outcomeCounts
+	Runs      int     `json:"runs"`
+	PassRate  float64 `json:"pass_rate"`
+	FailRate  float64 `json:"fail_rate"`
+	FlakeRate float64 `json:"flake_rate"`
+}
+
+func newJSONRates(c outcomeCounts) jsonRates {
+	runs := c.runs()
+	return jsonRates{
+		outcomeCounts: c,
+		Runs:          runs,
+		PassRate:      percent(c.Passed, runs),
+		FailRate:      percent(c.Failed, runs),
+		FlakeRate:     percent(c.Flaked, runs),
+	}
+}
+
+// Trends of the flake rate compared with the previous window.
+const (
+	trendNew  = "new"
+	trendUp   = "up"
+	trendDown = "down"
+	trendFlat = "flat"
+)
+
+type jsonWindowStats struct {
+	jsonRates
+
+	// Previous are the stats for the window of the same length that ends
+	// when this window starts.
+	Previous jsonRates `json:"previous"`
+
+	// Changes of rates in percentage points compared with the previous
+	// window. They are omitted if the test didn't run in the previous window.
+	PassRateChange  *float64 `json:"pass_rate_change,omitempty"`
+	FailRateChange  *float64 `json:"fail_rate_change,omitempty"`
+	FlakeRateChange *float64 `json:"flake_rate_change,omitempty"`
+
+	// Trend is the direction of the flake rate: new, up, down or flat.
+	Trend string `json:"trend"`
+}
+
+func change(current, previous float64) *float64 {
+	d := math.Round((current-previous)*100) / 100
+	return &d
+}
+
+func newJSONWindowStats(current, previous outcomeCounts) jsonWindowStats {
+	s := jsonWindowStats{
+		jsonRates: newJSONRates(current),
+		Previous:  newJSONRates(previous),
+		Trend:     trendNew,
+	}
+	if previous.runs() == 0 {
+		return s
+	}
+	s.PassRateChange = change(s.PassRate, s.Previous.PassRate)
+	s.FailRateChange = change(s.FailRate, s.Previous.FailRate)
+	s.FlakeRateChange = change(s.FlakeRate, s.Previous.FlakeRate)
+	switch {
+	case *s.FlakeRateChange > 0:
+		s.Trend = trendUp
+	case *s.FlakeRateChange < 0:
+		s.Trend = trendDown
+	default:
+		s.Trend = trendFlat
+	}
+	return s
+}
+
+type jsonJobFlakes struct {
+	Name    string                     `json:"name"`
+	Windows map[string]jsonWindowStats `json:"windows"`
+}
+
+type jsonTestFlakes struct {
+	Name    string                     `json:"name"`
+	Windows map[string]jsonWindowStats `json:"windows"`
+	Jobs    []jsonJobFlakes            `json:"jobs"`
+}
+
+type jsonFlakeSummary struct {
+	Generated time.Time        `json:"generated"`
+	Windows   []string         `json:"windows"`
+	Tests     []jsonTestFlakes `json:"tests"`
+}
+
+// windowCounts are counts for the current and the previous period of each
+// window.
+type windowCounts struct {
+	current  []outcomeCounts
+	previous []outcomeCounts
+}
+
+// flakeSummary aggregates outcomes of tests over time windows that end at
+// now.
+type flakeSummary struct {
+	now     time.Time
+	windows []flakeWindow
+	tests   map[string]map[string]*windowCounts
+}
+
+func newFlakeSummary(now time.Time, windows []flakeWindow) *flakeSummary {
+	return &flakeSummary{
+		now:     now,
+		windows: windows,
+		tests:   make(map[string]map[string]*windowCounts),
+	}
+}
+
+// add counts the outcome o of test in the build bs.
+func (s *flakeSummary) add(bs buildSummary, test string, o string) {
+	jobs := s.tests[test]
+	if jobs == nil {
+		jobs = make(map[string]*windowCounts)
+		s.tests[test] = jobs
+	}
+	counts := jobs[bs.Job]
+	if counts == nil {
+		counts = &windowCounts{
+			current:  make([]outcomeCounts, len(s.windows)),
+			previous: make([]outcomeCounts, len(s.windows)),
+		}
+		jobs[bs.Job] = counts
+	}
+
+	age := s.now.Sub(time.Unix(bs.Started, 0))
+	for i, w := range s.windows {
+		if age < w.duration {
+			counts.current[i].add(o)
+		} else if age < 2*w.duration {
+			counts.previous[i].add(o)
+		}
+	}
+}
+
+func (s *flakeSummary) windowStats(counts *windowCounts) map[string]jsonWindowStats {
+	stats := make(map[string]jsonWindowStats, len(s.windows))
+	for i, w := range s.windows {
+		stats[w.name] = newJSONWindowStats(counts.current[i], counts.previous[i])
+	}
+	return stats
+}
+
+// render returns the summary. Tests and jobs are sorted by the number of
+// flakes in the first window, then by the flake rate.
+func (s *flakeSummary) render() jsonFlakeSummary {
+	out := jsonFlakeSummary{
+		Generated: s.now.UTC(),
+		Tests:     []jsonTestFlakes{},
+	}
+	for _, w := range s.windows {
+		out.Windows = append(out.Windows, w.name)
+	}
+
+	for test, jobs := range s.tests {
+		total := &windowCounts{
+			current:  make([]outcomeCounts, len(s.windows)),
+			previous: make([]outcomeCounts, len(s.windows)),
+		}
+		t := jsonTestFlakes{
+			Name: test,
+		}
+		for job, counts := range jobs {
+			for i := range s.windows {
+				total.current[i].merge(counts.current[i])
+				total.previous[i].merge(counts.previous[i])
+			}
+			t.Jobs = append(t.Jobs, jsonJobFlakes{
+				Name:    job,
+				Windows: s.windowStats(counts),
+			})
+		}
+		t.Windows = s.windowStats(total)
+		sort.Slice(t.Jobs, func(i, j int) bool {
+			return s.less(t.Jobs[i].Windows, t.Jobs[j].Windows, t.Jobs[i].Name, t.Jobs[j].Name)
+		})
+		out.Tests = append(out.Tests, t)
+	}
+	sort.Slice(out.Tests, func(i, j int) bool {
+		return s.less(out.Tests[i].Windows, out.Tests[j].Windows, out.Tests[i].Name, out.Tests[j].Name)
+	})
+	return out
+}
+
+func (s *flakeSummary) less(a, b map[string]jsonWindowStats, aName, bName string) bool {
+	if len(s.windows) != 0 {
+		w := s.windows[0].name
+		if a[w].Flaked != b[w].Flaked {
+			return a[w].Flaked > b[w].Flaked
+		}
+		if a[w].FlakeRate != b[w].FlakeRate {
+			return a[w].FlakeRate > b[w].FlakeRate
+		}
+	}
+	return aName < bName
+}
@@ -0,0 +1,90 @@
+package exporttriage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckFlakeWindows(t *testing.T) {
+	const day = 24 * time.Hour
+
+	testCases := []struct {
+		name    string
+		windows []string
+		age     time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "default windows and age",
+			windows: []string{"24h", "7d"},
+			age:     14 * day,
+		},
+		{
+			name:    "window as long as age",
+			windows: []string{"24h", "7d", "14d"},
+			age:     14 * day,
+			wantErr: true,
+		},
+		{
+			name:    "window longer than half of age",
+			windows: []string{"8d"},
+			age:     14 * day,
+			wantErr: true,
+		},
+		{
+			name:    "long enough age",
+			windows: []string{"24h", "7d", "14d"},
+			age:     28 * day,
+		},
+		{
+			name:    "no age limit",
+			windows: []string{"30d"},
+			age:     0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			windows, err := parseFlakeWindows(tc.windows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkFlakeWindows(windows, tc.age)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("got error %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlakeSummaryPreviousWindow(t *testing.T) {
+	now := time.Now()
+	windows, err := parseFlakeWindows([]string{"7d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFlakeSummary(now, windows)
+
+	build := func(id string, age time.Duration) buildSummary {
+		return buildSummary{Job: "job", BuildID: id, Started: now.Add(-age).Unix()}
+	}
+	s.add(build("1", 13*24*time.Hour), "test", outcomePassed)
+	s.add(build("2", 8*24*time.Hour), "test", outcomePassed)
+	s.add(build("3", 2*24*time.Hour), "test", outcomeFlaked)
+	s.add(build("4", time.Hour), "test", outcomePassed)
+	s.add(build("5", 15*24*time.Hour), "test", outcomeFailed)
+
+	out := s.render()
+	if len(out.Tests) != 1 {
+		t.Fatalf("got %d tests, want 1", len(out.Tests))
+	}
+	stats := out.Tests[0].Windows["7d"]
+	if stats.Runs != 2 || stats.Flaked != 1 {
+		t.Errorf("current window: got %d runs and %d flakes, want 2 and 1", stats.Runs, stats.Flaked)
+	}
+	if stats.Previous.Runs != 2 || stats.Previous.Passed != 2 {
+		t.Errorf("previous window: got %d runs and %d passes, want 2 and 2", stats.Previous.Runs, stats.Previous.Passed)
+	}
+	if stats.Trend != trendUp {
+		t.Errorf("trend: got %s, want %s", stats.Trend, trendUp)
+	}
+}
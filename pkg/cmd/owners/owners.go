@@ -0,0 +1,110 @@
+package owners
+
+import (
+	"context"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cmd/exporttriage"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/summarize"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type OwnersOptions struct {
+	Config              string
+	Tests               []string
+	Output              string
+	NumWorkers          int
+	AgeLimit            time.Duration
+	NormalizationConfig string
+	Artifacts           artifacts.Options
+}
+
+func (opts *OwnersOptions) Run(ctx context.Context) error {
+	var overrides []config.OwnerOverride
+	if opts.Config != "" {
+		cfg, err := config.LoadOwnersConfigFromFile(opts.Config)
+		if err != nil {
+			return err
+		}
+		overrides = cfg.Overrides
+	}
+
+	var in *summarize.Input
+	if len(opts.Tests) != 0 {
+		var err error
+		in, err = summarize.LoadInput("", opts.Tests)
+		if err != nil {
+			return err
+		}
+	} else {
+		in = summarize.NewInput()
+		e := &exporttriage.ExportTriageOptions{
+			NumWorkers:          opts.NumWorkers,
+			AgeLimit:            opts.AgeLimit,
+			Artifacts:           opts.Artifacts,
+			NormalizationConfig: opts.NormalizationConfig,
+			Input:               in,
+		}
+		if err := e.Run(ctx); err != nil {
+			return err
+		}
+	}
+
+	owners, err := summarize.GenerateOwners(in, overrides)
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Found %d owners", len(owners))
+
+	return summarize.WriteOwners(opts.Output, owners)
+}
+
+func NewCmdOwners() *cobra.Command {
+	opts := &OwnersOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "owners",
+		Short: "Generate the test owners file for clustering",
+		Long: heredoc.Doc(`
+			Generate the test owners file for the cluster command from names of
+			failed tests.
+
+			Tests are assigned to owners by their [sig-xxx] tags. Tests without
+			tags can be assigned to owners by regular expressions from the YAML
+			file --config:
+
+			    overrides:
+			    - pattern: '^operator\.'
+			      owner: cluster-lifecycle
+
+			Owners may contain only letters, digits, '-' and '_'. Tests are saved
+			with the "$" suffix, so the cluster command matches their whole names
+			instead of using them as prefixes.
+
+			By default, failed tests are exported from the database. Files
+			produced by export-triage can be used instead with --tests.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Config, "config", "", "YAML file with owner overrides")
+	cmd.Flags().StringSliceVar(&opts.Tests, "tests", nil, "files with tests json, empty to export tests from the database")
+	cmd.Flags().StringVar(&opts.Output, "output", "owners.json", "file to save owners json")
+	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn for export")
+	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "export only builds that are younger than the theshold")
+	cmd.Flags().StringVar(&opts.NormalizationConfig, "normalization_config", "", "YAML file with rules that normalize names of exported tests (see the test-names command)")
+	opts.Artifacts.AddFlags(cmd.Flags())
+
+	return cmd
+}
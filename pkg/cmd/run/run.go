@@ -0,0 +1,652 @@
+package run
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/atomicfile"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/cmd/cleanup"
+	"github.com/dmage/triage/pkg/cmd/discovertestgrid"
+	"github.com/dmage/triage/pkg/cmd/exporttriage"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/history"
+	"github.com/dmage/triage/pkg/summarize"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+const (
+	stageUpdate   = "update"
+	stageDiscover = "discover"
+	stageCleanup  = "cleanup"
+	stageTriage   = "triage"
+	stagePublish  = "publish"
+)
+
+var defaultStageTimeouts = map[string]time.Duration{
+	stageUpdate:   10 * time.Minute,
+	stageDiscover: 2 * time.Hour,
+	stageCleanup:  30 * time.Minute,
+	stageTriage:   2 * time.Hour,
+	stagePublish:  10 * time.Minute,
+}
+
+const (
+	statusPending   = "pending"
+	statusRunning   = "running"
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+)
+
+type stageStatus struct {
+	Name     string     `json:"name"`
+	Status   string     `json:"status"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type cycleStatus struct {
+	Started            time.Time      `json:"started"`
+	Finished           *time.Time     `json:"finished,omitempty"`
+	Stages             []*stageStatus `json:"stages"`
+	LastSucceeded      *time.Time     `json:"last_succeeded,omitempty"`
+	LastFullClustering *time.Time     `json:"last_full_clustering,omitempty"`
+	SkippedCycles      int            `json:"skipped_cycles"`
+}
+
+type RunOptions struct {
+	Interval            time.Duration
+	Once                bool
+	TestInfraRepo       string
+	TestInfraDir        string
+	TestGridConfigs     []string
+	AgeLimit            time.Duration
+	NumWorkers          int
+	Retries             int
+	MaxFailedGroups     int
+	TriageNumWorkers    int
+	FullClusterInterval time.Duration
+	OwnersConfig        string
+	NormalizationConfig string
+	Output              string
+	HistoryRetention    time.Duration
+	StatusFile          string
+	StageTimeouts       map[string]string
+	Artifacts           artifacts.Options
+
+	stageTimeouts map[string]time.Duration
+
+	mu     sync.Mutex
+	status cycleStatus
+}
+
+func (opts *RunOptions) saveStatus() {
+	if opts.StatusFile == "" {
+		return
+	}
+
+	err := func() error {
+		f, err := atomicfile.Create(opts.StatusFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(opts.status); err != nil {
+			return err
+		}
+		return f.Commit()
+	}()
+	if err != nil {
+		klog.Warningf("Unable to save status into %s: %s", opts.StatusFile, err)
+	}
+}
+
+func (opts *RunOptions) setStageStatus(stage *stageStatus, status string, err error) {
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+
+	now := time.Now()
+	stage.Status = status
+	switch status {
+	case statusRunning:
+		stage.Started = &now
+	case statusSucceeded, statusFailed:
+		stage.Finished = &now
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	opts.saveStatus()
+}
+
+func (opts *RunOptions) git(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (opts *RunOptions) updateTestInfra(ctx context.Context) error {
+	if _, err := os.Stat(opts.TestInfraDir); err == nil {
+		err := opts.git(ctx, "-C", opts.TestInfraDir, "pull", "--rebase")
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		klog.Warningf("Unable to update %s, cloning it again: %s", opts.TestInfraDir, err)
+		if err := os.RemoveAll(opts.TestInfraDir); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return opts.git(ctx, "clone", opts.TestInfraRepo, opts.TestInfraDir)
+}
+
+func (opts *RunOptions) discover(ctx context.Context) error {
+	var configPaths []string
+	for _, pattern := range opts.TestGridConfigs {
+		matches, err := filepath.Glob(filepath.Join(opts.TestInfraDir, pattern))
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		configPaths = append(configPaths, matches...)
+	}
+	if len(configPaths) == 0 {
+		return fmt.Errorf("no TestGrid configs found in %s", opts.TestInfraDir)
+	}
+
+	d := &discovertestgrid.DiscoverTestGridOptions{
+		ConfigPaths:     configPaths,
+		NumWorkers:      opts.NumWorkers,
+		AgeLimit:        opts.AgeLimit,
+		Retries:         opts.Retries,
+		MaxFailedGroups: opts.MaxFailedGroups,
+		Artifacts:       opts.Artifacts,
+	}
+	return d.Run(ctx)
+}
+
+func (opts *RunOptions) cleanup(ctx context.Context) error {
+	c := &cleanup.CleanupOptions{
+		AgeLimit: opts.AgeLimit,
+	}
+	return c.Run(ctx)
+}
+
+// triage exports builds from the database and clusters their failures. The
+// results are written into staging.
+func (opts *RunOptions) triage(ctx context.Context, staging string) error {
+	if err := os.MkdirAll(filepath.Join(staging, "slices"), 0755); err != nil {
+		return err
+	}
+
+	in := summarize.NewInput()
+	e := &exporttriage.ExportTriageOptions{
+		NumWorkers:          opts.NumWorkers,
+		AgeLimit:            opts.AgeLimit,
+		Artifacts:           opts.Artifacts,
+		NormalizationConfig: opts.NormalizationConfig,
+		Input:               in,
+	}
+	if err := e.Run(ctx); err != nil {
+		return err
+	}
+
+	var overrides []config.OwnerOverride
+	if opts.OwnersConfig != "" {
+		cfg, err := config.LoadOwnersConfigFromFile(opts.OwnersConfig)
+		if err != nil {
+			return err
+		}
+		overrides = cfg.Overrides
+	}
+	owners, err := summarize.GenerateOwners(in, overrides)
+	if err != nil {
+		return err
+	}
+
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The time of the last full clustering is kept in the database, so that
+	// restarts and --once runs don't cause full clusterings.
+	incremental := false
+	lastFull, err := db.LoadLastFullClustering()
+	if err == nil {
+		opts.mu.Lock()
+		opts.status.LastFullClustering = &lastFull
+		opts.mu.Unlock()
+		incremental = time.Since(lastFull) < opts.FullClusterInterval
+	} else if !cache.IsNotFound(err) {
+		return fmt.Errorf("unable to load the time of the last full clustering: %w", err)
+	}
+	if incremental {
+		klog.Infof("Clustering only new failures, the last full clustering was at %s", lastFull.Format(time.RFC3339))
+	}
+
+	s := &summarize.Options{
+		Output:       filepath.Join(staging, "failure_data.json"),
+		OutputSlices: filepath.Join(staging, "slices", "failure_data_PREFIX.json"),
+		Previous:     filepath.Join(opts.Output, "failure_data.json"),
+		OwnersMap:    owners,
+		NumWorkers:   opts.TriageNumWorkers,
+		Assignments:  db,
+		Incremental:  incremental,
+	}
+	started := time.Now()
+	if err := s.Run(ctx, in); err != nil {
+		return err
+	}
+
+	if !incremental {
+		if err := db.SaveLastFullClustering(started); err != nil {
+			return fmt.Errorf("unable to save the time of the last full clustering: %w", err)
+		}
+		opts.mu.Lock()
+		opts.status.LastFullClustering = &started
+		opts.mu.Unlock()
+	}
+	return nil
+}
+
+// writeTar archives files from dir into w. Names in the archive are relative
+// to dir.
+func writeTar(w io.Writer, dir string, names []string) error {
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		err := filepath.Walk(filepath.Join(dir, name), func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, filename)
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+const (
+	// generationPrefix is the prefix of directories with published results.
+	generationPrefix = ".gen-"
+
+	// latestLink is the symlink to the latest generation of results.
+	latestLink = "latest"
+
+	// keptGenerations is the number of generations that are kept, so that
+	// readers can finish reading the previous one.
+	keptGenerations = 2
+)
+
+// publishedFiles are the results that are available in the output directory
+// as symlinks into the latest generation.
+var publishedFiles = []string{"failure_data.json", "failure_data.tar", "slices"}
+
+// replaceWithSymlink atomically replaces name with a symlink to target.
+func replaceWithSymlink(target, name string) error {
+	tmp := name + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ensureSymlink makes name a symlink to target if it is not one yet.
+func ensureSymlink(target, name string) error {
+	if t, err := os.Readlink(name); err == nil && t == target {
+		return nil
+	}
+	// Older versions published slices as a directory.
+	if fi, err := os.Lstat(name); err == nil && fi.IsDir() {
+		if err := os.RemoveAll(name); err != nil {
+			return err
+		}
+	}
+	return replaceWithSymlink(target, name)
+}
+
+// removeOldGenerations removes all generations except the newest
+// keptGenerations ones.
+func (opts *RunOptions) removeOldGenerations() error {
+	entries, err := ioutil.ReadDir(opts.Output)
+	if err != nil {
+		return err
+	}
+	var generations []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), generationPrefix) {
+			generations = append(generations, e.Name())
+		}
+	}
+	sort.Strings(generations)
+	for len(generations) > keptGenerations {
+		if err := os.RemoveAll(filepath.Join(opts.Output, generations[0])); err != nil {
+			return err
+		}
+		generations = generations[1:]
+	}
+	return nil
+}
+
+// publish turns staging into a new generation of results and atomically
+// switches the latest symlink in the output directory to it.
+// failure_data.json, failure_data.tar and slices in the output directory are
+// symlinks into latest, so readers never see files from different
+// generations, and slices that are no longer produced disappear. A copy of
+// failure_data.json is kept in the history directory as the snapshot for the
+// current day.
+func (opts *RunOptions) publish(staging string) error {
+	tarFile, err := os.Create(filepath.Join(staging, "failure_data.tar"))
+	if err != nil {
+		return err
+	}
+	err = writeTar(tarFile, staging, []string{"failure_data.json", "slices"})
+	if closeErr := tarFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create failure_data.tar: %w", err)
+	}
+
+	// The staging directory is created only accessible by its owner.
+	if err := os.Chmod(staging, 0755); err != nil {
+		return err
+	}
+	generation := fmt.Sprintf("%s%d", generationPrefix, time.Now().UnixNano())
+	if err := os.Rename(staging, filepath.Join(opts.Output, generation)); err != nil {
+		return err
+	}
+	if err := replaceWithSymlink(generation, filepath.Join(opts.Output, latestLink)); err != nil {
+		return fmt.Errorf("unable to switch to the new results: %w", err)
+	}
+	for _, name := range publishedFiles {
+		if err := ensureSymlink(filepath.Join(latestLink, name), filepath.Join(opts.Output, name)); err != nil {
+			return err
+		}
+	}
+
+	if opts.HistoryRetention != 0 {
+		historyDir := filepath.Join(opts.Output, "history")
+		now := time.Now()
+		if err := history.Save(historyDir, now, filepath.Join(opts.Output, generation, "failure_data.json")); err != nil {
+			return fmt.Errorf("unable to save history snapshot: %w", err)
+		}
+		if err := history.Prune(historyDir, now, opts.HistoryRetention); err != nil {
+			return fmt.Errorf("unable to remove old history snapshots: %w", err)
+		}
+	}
+
+	return opts.removeOldGenerations()
+}
+
+func (opts *RunOptions) cycle(ctx context.Context) (err error) {
+	if err := os.MkdirAll(opts.Output, 0755); err != nil {
+		return err
+	}
+
+	// The staging directory is in the output directory, so it can be
+	// renamed into a generation of results.
+	staging, err := ioutil.TempDir(opts.Output, ".new-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	stages := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{stageUpdate, opts.updateTestInfra},
+		{stageDiscover, opts.discover},
+		{stageCleanup, opts.cleanup},
+		{stageTriage, func(ctx context.Context) error { return opts.triage(ctx, staging) }},
+		{stagePublish, func(ctx context.Context) error { return opts.publish(staging) }},
+	}
+
+	opts.mu.Lock()
+	opts.status.Started = time.Now()
+	opts.status.Finished = nil
+	opts.status.Stages = nil
+	for _, s := range stages {
+		opts.status.Stages = append(opts.status.Stages, &stageStatus{
+			Name:   s.name,
+			Status: statusPending,
+		})
+	}
+	statuses := opts.status.Stages
+	opts.saveStatus()
+	opts.mu.Unlock()
+
+	defer func() {
+		opts.mu.Lock()
+		defer opts.mu.Unlock()
+		now := time.Now()
+		opts.status.Finished = &now
+		if err == nil {
+			opts.status.LastSucceeded = &now
+		}
+		opts.saveStatus()
+	}()
+
+	for i, s := range stages {
+		if s.name == stageUpdate && opts.TestInfraRepo == "" {
+			opts.setStageStatus(statuses[i], statusSkipped, nil)
+			continue
+		}
+
+		klog.Infof("Starting stage %s...", s.name)
+		opts.setStageStatus(statuses[i], statusRunning, nil)
+
+		started := time.Now()
+		stageCtx, cancel := context.WithTimeout(ctx, opts.stageTimeouts[s.name])
+		err = s.run(stageCtx)
+		timedOut := stageCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+
+		if err != nil {
+			if timedOut {
+				err = fmt.Errorf("timed out after %s: %w", opts.stageTimeouts[s.name], err)
+			}
+			err = fmt.Errorf("stage %s failed: %w", s.name, err)
+			opts.setStageStatus(statuses[i], statusFailed, err)
+			for _, st := range statuses[i+1:] {
+				opts.setStageStatus(st, statusSkipped, nil)
+			}
+			return err
+		}
+
+		klog.Infof("Stage %s succeeded in %s", s.name, time.Since(started).Round(time.Second))
+		opts.setStageStatus(statuses[i], statusSucceeded, nil)
+	}
+	return nil
+}
+
+func (opts *RunOptions) parseStageTimeouts() error {
+	opts.stageTimeouts = make(map[string]time.Duration)
+	for name, timeout := range defaultStageTimeouts {
+		opts.stageTimeouts[name] = timeout
+	}
+	for name, value := range opts.StageTimeouts {
+		if _, ok := defaultStageTimeouts[name]; !ok {
+			var names []string
+			for name := range defaultStageTimeouts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown stage %q, expected one of: %s", name, strings.Join(names, ", "))
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid timeout for stage %s: %w", name, err)
+		}
+		opts.stageTimeouts[name] = timeout
+	}
+	return nil
+}
+
+func (opts *RunOptions) Run(ctx context.Context) error {
+	if err := opts.parseStageTimeouts(); err != nil {
+		return err
+	}
+
+	if opts.Once {
+		return opts.cycle(ctx)
+	}
+
+	var wg sync.WaitGroup
+	running := make(chan struct{}, 1)
+	start := func() {
+		select {
+		case running <- struct{}{}:
+		default:
+			klog.Warningf("The previous cycle is still running, skipping this one")
+			opts.mu.Lock()
+			opts.status.SkippedCycles++
+			opts.saveStatus()
+			opts.mu.Unlock()
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-running }()
+
+			if err := opts.cycle(ctx); err != nil {
+				klog.Errorf("Cycle failed: %s", err)
+			}
+		}()
+	}
+
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+
+	start()
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("Waiting for the running cycle to stop...")
+			wg.Wait()
+			return nil
+		case <-t.C:
+			start()
+		}
+	}
+}
+
+func NewCmdRun() *cobra.Command {
+	opts := &RunOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Periodically update triage results",
+		Long: heredoc.Doc(`
+			Periodically discover new builds from TestGrid configuration in
+			test-infra, cluster their failures and publish the results into the
+			output directory.
+
+			Each cycle consists of the stages update, discover, cleanup, triage
+			and publish. If a stage fails or times out, the rest of the cycle is
+			skipped. A new cycle is not started while the previous one is
+			running. The status of the last cycle is saved into --status_file.
+
+			The triage stage keeps failures in the clusters that they were
+			assigned to by the previous cycles and clusters only new failures;
+			all failures are clustered again every --full_cluster_interval. This
+			saves only the clustering itself: the results include every failure
+			from the last --age, so all of them are still exported and rendered
+			each cycle.
+
+			Owners of clusters are determined by [sig-xxx] tags in test names and,
+			for tests without tags, by overrides from --owners_config.
+
+			Each cycle publishes its results into a new directory in --output
+			and switches the symlink latest to it. failure_data.json,
+			failure_data.tar and slices in --output are symlinks into latest.
+
+			A snapshot of the results is kept for every day in the history
+			directory of --output for --history_retention.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&opts.Interval, "interval", 30*time.Minute, "interval between starts of cycles")
+	cmd.Flags().BoolVar(&opts.Once, "once", false, "run one cycle and exit")
+	cmd.Flags().StringVar(&opts.TestInfraRepo, "testinfra_repo", "https://github.com/kubernetes/test-infra.git", "git repository with TestGrid configuration, empty to use --testinfra_dir as is")
+	cmd.Flags().StringVar(&opts.TestInfraDir, "testinfra_dir", "./cache/test-infra", "directory for the checkout of --testinfra_repo")
+	cmd.Flags().StringSliceVar(&opts.TestGridConfigs, "testgrid_config", []string{"config/testgrids/openshift/redhat-openshift-*.yaml"}, "patterns for TestGrid configuration files in --testinfra_dir")
+	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "index only builds that are younger than the theshold")
+	cmd.Flags().IntVarP(&opts.NumWorkers, "num_workers", "w", 10, "number of workers to spawn for discovery and export of builds")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 2, "number of retries for test groups that failed")
+	cmd.Flags().IntVar(&opts.MaxFailedGroups, "max_failed_groups", -1, "number of failed test groups that doesn't fail the discover stage, -1 for no limit")
+	cmd.Flags().IntVar(&opts.TriageNumWorkers, "triage_num_workers", summarize.DefaultNumWorkers, "number of workers for clustering")
+	cmd.Flags().StringVar(&opts.NormalizationConfig, "normalization_config", "", "YAML file with rules that normalize test names (see the test-names command)")
+	cmd.Flags().StringVar(&opts.OwnersConfig, "owners_config", "", "YAML file with overrides for owners of tests (see the owners command)")
+	cmd.Flags().DurationVar(&opts.FullClusterInterval, "full_cluster_interval", 24*time.Hour, "interval between clusterings of all failures, 0 to cluster all failures every cycle")
+	cmd.Flags().StringVar(&opts.Output, "output", "./output", "directory to publish triage results into")
+	cmd.Flags().DurationVar(&opts.HistoryRetention, "history_retention", 30*24*time.Hour, "how long to keep daily snapshots of results in the history directory of --output, 0 to disable snapshots")
+	cmd.Flags().StringVar(&opts.StatusFile, "status_file", "./output/status.json", "file to save the status of the last cycle into, empty to disable")
+	cmd.Flags().StringToStringVar(&opts.StageTimeouts, "stage_timeout", nil, "timeouts for stages (e.g. discover=3h,triage=1h), defaults: update=10m, discover=2h, cleanup=30m, triage=2h, publish=10m")
+	opts.Artifacts.AddFlags(cmd.Flags())
+
+	return cmd
+}
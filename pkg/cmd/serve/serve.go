@@ -5,10 +5,16 @@ import (
 	"embed"
 	"io/fs"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/NYTimes/gziphandler"
+	"github.com/dmage/triage/pkg/history"
 	"github.com/gorilla/handlers"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
@@ -19,6 +25,38 @@ var static embed.FS
 
 type ServeOptions struct {
 	FailureData string
+	HistoryURL  string
+}
+
+// historyHandler serves daily snapshots from the history directory of the
+// failure data or, if HistoryURL is set, from another server.
+func (opts *ServeOptions) historyHandler() (http.Handler, error) {
+	var handler http.Handler
+	if opts.HistoryURL != "" {
+		u, err := url.Parse(opts.HistoryURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		handler = http.StripPrefix("/data/history/", proxy)
+	} else {
+		handler = http.StripPrefix("/data/history/", http.FileServer(http.Dir(filepath.Join(opts.FailureData, "history"))))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/data/history/")
+		if !history.IsValidName(name) {
+			http.NotFound(w, r)
+			return
+		}
+		// Snapshots of past days don't change.
+		if name == history.Name(time.Now()) {
+			w.Header().Set("Cache-Control", "max-age=120")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=86400")
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
 }
 
 func (opts *ServeOptions) Run(ctx context.Context) error {
@@ -37,10 +75,34 @@ func (opts *ServeOptions) Run(ctx context.Context) error {
 	})
 	mux.Handle("/data/", gziphandler.GzipHandler(cachedDataHandler))
 
+	historyHandler, err := opts.historyHandler()
+	if err != nil {
+		return err
+	}
+	mux.Handle("/data/history/", gziphandler.GzipHandler(historyHandler))
+
 	handler := handlers.CombinedLoggingHandler(os.Stdout, mux)
 
-	klog.Info("Listening http://localhost:8080...")
-	return http.ListenAndServe(":8080", handler)
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: handler,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		klog.Info("Listening http://localhost:8080...")
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		klog.Info("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
 }
 
 func NewCmdServe() *cobra.Command {
@@ -51,6 +113,9 @@ func NewCmdServe() *cobra.Command {
 		Short: "Start an HTTP server",
 		Long: heredoc.Doc(`
 			Start an HTTP server with a failure viewer.
+
+			Daily snapshots of triage results are served from the history
+			directory of --failure_data, or from --history_url if it is set.
 		`),
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -62,6 +127,7 @@ func NewCmdServe() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&opts.FailureData, "failure_data", "./", "path to a directory with triage results")
+	cmd.Flags().StringVar(&opts.HistoryURL, "history_url", "", "base URL of a server with daily snapshots (e.g. http://scraper/data/history/)")
 
 	return cmd
 }
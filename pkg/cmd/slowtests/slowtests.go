@@ -0,0 +1,241 @@
+package slowtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/builddata"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/kvcache"
+	"github.com/dmage/triage/pkg/testname"
+	"github.com/dmage/triage/pkg/window"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type SlowTestsOptions struct {
+	Window              string
+	Baseline            string
+	Threshold           float64
+	MinSamples          int
+	MinDuration         time.Duration
+	NormalizationConfig string
+
+	out io.Writer
+}
+
+type key struct {
+	job  string
+	test string
+}
+
+// samples are durations of successful runs of a test on a job in seconds.
+type samples struct {
+	current  []float64
+	baseline []float64
+}
+
+// percentile returns the p-th percentile of sorted values using the
+// nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+type regression struct {
+	job, test          string
+	currentRuns        int
+	baselineRuns       int
+	baselineP50, p50   float64
+	baselineP90, p90   float64
+	ratioP50, ratioP90 float64
+}
+
+func (r regression) maxRatio() float64 {
+	return math.Max(r.ratioP50, r.ratioP90)
+}
+
+func (opts *SlowTestsOptions) Run(ctx context.Context) error {
+	if opts.out == nil {
+		opts.out = os.Stdout
+	}
+
+	current, err := window.Parse(opts.Window)
+	if err != nil {
+		return err
+	}
+	baseline, err := window.Parse(opts.Baseline)
+	if err != nil {
+		return err
+	}
+
+	normalizer, err := testname.NewNormalizerFromFile(opts.NormalizationConfig)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	currentStart := now.Add(-current).Unix()
+	baselineStart := now.Add(-current - baseline).Unix()
+
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	kv := kvcache.NewDefaultKVCache()
+
+	builds, err := db.FindBuilds(baselineStart)
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Found %d builds", len(builds))
+
+	tests := make(map[key]*samples)
+	for _, build := range builds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		buildData := &builddata.BuildData{}
+		err := kv.Load(builddata.CacheKey(build), buildData)
+		if kvcache.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		started := buildData.StartedJson.Timestamp
+		if started < baselineStart {
+			continue
+		}
+
+		for _, r := range buildData.TestResults {
+			// Failed runs may be cut short by timeouts.
+			if r.Status != artifacts.TestStatusSuccess || r.Duration <= 0 {
+				continue
+			}
+
+			k := key{job: build.Job, test: normalizer.Normalize(r.Test)}
+			s := tests[k]
+			if s == nil {
+				s = &samples{}
+				tests[k] = s
+			}
+			if started >= currentStart {
+				s.current = append(s.current, r.Duration)
+			} else {
+				s.baseline = append(s.baseline, r.Duration)
+			}
+		}
+	}
+
+	var regressions []regression
+	for k, s := range tests {
+		if len(s.current) < opts.MinSamples || len(s.baseline) < opts.MinSamples {
+			continue
+		}
+		sort.Float64s(s.current)
+		sort.Float64s(s.baseline)
+
+		r := regression{
+			job:          k.job,
+			test:         k.test,
+			currentRuns:  len(s.current),
+			baselineRuns: len(s.baseline),
+			baselineP50:  percentile(s.baseline, 50),
+			p50:          percentile(s.current, 50),
+			baselineP90:  percentile(s.baseline, 90),
+			p90:          percentile(s.current, 90),
+		}
+		if r.p90 < opts.MinDuration.Seconds() {
+			continue
+		}
+		if r.baselineP50 > 0 {
+			r.ratioP50 = r.p50 / r.baselineP50
+		}
+		if r.baselineP90 > 0 {
+			r.ratioP90 = r.p90 / r.baselineP90
+		}
+		if r.ratioP50 < opts.Threshold && r.ratioP90 < opts.Threshold {
+			continue
+		}
+		regressions = append(regressions, r)
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].maxRatio() != regressions[j].maxRatio() {
+			return regressions[i].maxRatio() > regressions[j].maxRatio()
+		}
+		if regressions[i].job != regressions[j].job {
+			return regressions[i].job < regressions[j].job
+		}
+		return regressions[i].test < regressions[j].test
+	})
+
+	klog.V(2).Infof("Found %d slow tests out of %d", len(regressions), len(tests))
+
+	w := tabwriter.NewWriter(opts.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "JOB\tTEST\tP50\tBASELINE P50\tP90\tBASELINE P90\tRUNS\tBASELINE RUNS\n")
+	for _, r := range regressions {
+		fmt.Fprintf(w, "%s\t%s\t%s (x%.1f)\t%s\t%s (x%.1f)\t%s\t%d\t%d\n",
+			r.job, r.test,
+			seconds(r.p50), r.ratioP50, seconds(r.baselineP50),
+			seconds(r.p90), r.ratioP90, seconds(r.baselineP90),
+			r.currentRuns, r.baselineRuns,
+		)
+	}
+	return w.Flush()
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
+
+func NewCmdSlowTests() *cobra.Command {
+	opts := &SlowTestsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "slow-tests",
+		Short: "Report tests that became slower",
+		Long: heredoc.Doc(`
+			Report tests whose p50 or p90 duration on a job rose past --threshold
+			times its duration in the baseline window. The baseline window ends
+			when --window starts.
+
+			Durations of successful runs are read from cached builds. Builds that
+			were cached before durations were collected are ignored.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Window, "window", "7d", "the window to check (e.g. 24h, 7d)")
+	cmd.Flags().StringVar(&opts.Baseline, "baseline", "7d", "the window to compare with")
+	cmd.Flags().Float64Var(&opts.Threshold, "threshold", 1.5, "minimal ratio of p50 or p90 to report")
+	cmd.Flags().IntVar(&opts.MinSamples, "min_samples", 3, "minimal number of successful runs in each window")
+	cmd.Flags().DurationVar(&opts.MinDuration, "min_duration", 10*time.Second, "ignore tests with p90 shorter than this")
+	cmd.Flags().StringVar(&opts.NormalizationConfig, "normalization_config", "", "YAML file with rules that normalize test names (see the test-names command)")
+
+	return cmd
+}
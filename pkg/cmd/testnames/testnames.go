@@ -0,0 +1,192 @@
+package testnames
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/builddata"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/kvcache"
+	"github.com/dmage/triage/pkg/testname"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type TestNamesOptions struct {
+	Config         string
+	BaselineConfig string
+	AgeLimit       time.Duration
+
+	createdAfter int64
+	out          io.Writer
+}
+
+// group is a name produced by the new rules and the names produced by the
+// baseline rules that it consists of.
+type group struct {
+	name  string
+	names []string
+}
+
+// groupsOf returns groups of names that have more than one name in names.
+func groupsOf(names map[string]map[string]bool) []group {
+	var groups []group
+	for name, baselineNames := range names {
+		if len(baselineNames) < 2 {
+			continue
+		}
+		g := group{name: name}
+		for n := range baselineNames {
+			g.names = append(g.names, n)
+		}
+		sort.Strings(g.names)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].names) != len(groups[j].names) {
+			return len(groups[i].names) > len(groups[j].names)
+		}
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+func (opts *TestNamesOptions) Run(ctx context.Context) error {
+	if opts.AgeLimit != 0 {
+		opts.createdAfter = time.Now().Add(-opts.AgeLimit).Unix()
+	}
+	if opts.out == nil {
+		opts.out = os.Stdout
+	}
+
+	normalizer, err := testname.NewNormalizerFromFile(opts.Config)
+	if err != nil {
+		return err
+	}
+	baseline, err := testname.NewNormalizerFromFile(opts.BaselineConfig)
+	if err != nil {
+		return err
+	}
+
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	kv := kvcache.NewDefaultKVCache()
+
+	builds, err := db.FindBuilds(opts.createdAfter)
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Found %d builds", len(builds))
+
+	rawNames := make(map[string]bool)
+	notCached := 0
+	for _, build := range builds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		buildData := &builddata.BuildData{}
+		err := kv.Load(builddata.CacheKey(build), buildData)
+		if kvcache.IsNotFound(err) {
+			notCached++
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, r := range buildData.TestResults {
+			if r.Synthetic {
+				continue
+			}
+			rawNames[r.Test] = true
+		}
+	}
+	if notCached != 0 {
+		klog.V(2).Infof("%d builds are not in the cache, skipping them", notCached)
+	}
+
+	// merged maps names under the new rules to names under the baseline
+	// rules, split maps them the other way around.
+	merged := make(map[string]map[string]bool)
+	split := make(map[string]map[string]bool)
+	for raw := range rawNames {
+		name := normalizer.Normalize(raw)
+		baselineName := baseline.Normalize(raw)
+		if merged[name] == nil {
+			merged[name] = make(map[string]bool)
+		}
+		merged[name][baselineName] = true
+		if split[baselineName] == nil {
+			split[baselineName] = make(map[string]bool)
+		}
+		split[baselineName][name] = true
+	}
+
+	fmt.Fprintf(opts.out, "%d test names, %d after baseline rules, %d after new rules\n", len(rawNames), len(split), len(merged))
+
+	opts.printGroups("merge", groupsOf(merged))
+
+	// Names that the baseline rules merge, but the new rules don't.
+	if splitGroups := groupsOf(split); len(splitGroups) != 0 {
+		opts.printGroups("split", splitGroups)
+	}
+
+	return nil
+}
+
+func (opts *TestNamesOptions) printGroups(what string, groups []group) {
+	fmt.Fprintf(opts.out, "\n%d names %s:\n", len(groups), what)
+	for _, g := range groups {
+		fmt.Fprintf(opts.out, "\n%s (%d names)\n", g.name, len(g.names))
+		for _, n := range g.names {
+			fmt.Fprintf(opts.out, "    %s\n", n)
+		}
+	}
+}
+
+func NewCmdTestNames() *cobra.Command {
+	opts := &TestNamesOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "test-names",
+		Short: "Dry-run test name normalization rules",
+		Long: heredoc.Doc(`
+			Apply test name normalization rules to names of tests from cached
+			builds and report which names merge compared to the baseline rules.
+
+			Rules are applied in order, then runs of spaces are collapsed and
+			names are trimmed:
+
+			    rules:
+			    - pattern: '\[Suite:[^]]*\]'
+			    - pattern: '\[(Serial|Slow|Disruptive)\]'
+			    - pattern: 'e2e-test-[a-z0-9]+'
+			      replacement: 'e2e-test-XXXXX'
+
+			Without --config and --baseline_config, the default rules are used.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Config, "config", "", "YAML file with the rules to try")
+	cmd.Flags().StringVar(&opts.BaselineConfig, "baseline_config", "", "YAML file with the rules to compare with")
+	cmd.Flags().DurationVar(&opts.AgeLimit, "age", 14*24*time.Hour, "use only builds that are younger than the theshold")
+
+	return cmd
+}
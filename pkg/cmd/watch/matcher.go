@@ -0,0 +1,111 @@
+package watch
+
+import (
+	"path"
+	"strings"
+
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/notifications"
+	"github.com/dmage/triage/pkg/types"
+)
+
+type location struct {
+	scheme string
+	bucket string
+	prefix string
+	group  config.TestGroup
+}
+
+// buildMatcher finds test groups for finished.json objects.
+type buildMatcher struct {
+	// flat maps bucket/<prefix> to test groups with builds in
+	// <prefix>/<build-id>/.
+	flat map[string]location
+
+	// directories maps bucket/<job> to test groups with links in
+	// pr-logs/directory/<job>/.
+	directories map[string]location
+
+	// pulls are test groups with builds in
+	// <prefix>/<pull-number>/<job>/<build-id>/.
+	pulls []location
+}
+
+func newBuildMatcher(testGroups []config.TestGroup) (*buildMatcher, error) {
+	m := &buildMatcher{
+		flat:        make(map[string]location),
+		directories: make(map[string]location),
+	}
+	for _, tg := range testGroups {
+		scheme, bucket, prefix, err := artifacts.ParseLocation(tg.GCSPrefix)
+		if err != nil {
+			return nil, err
+		}
+		loc := location{
+			scheme: scheme,
+			bucket: bucket,
+			prefix: prefix,
+			group:  tg,
+		}
+		switch {
+		case tg.Presubmit:
+			m.pulls = append(m.pulls, loc)
+		case strings.Contains("/"+prefix, "/pr-logs/directory/"):
+			m.directories[bucket+"/"+path.Base(prefix)] = loc
+		default:
+			m.flat[bucket+"/"+prefix] = loc
+		}
+	}
+	return m, nil
+}
+
+// Match returns the build that owns the object from event if the event says
+// that the build is finished.
+func (m *buildMatcher) Match(event notifications.Event) *types.Build {
+	if event.EventType != "" && event.EventType != notifications.EventTypeObjectFinalize {
+		return nil
+	}
+	if !strings.HasSuffix(event.Object, "/finished.json") {
+		return nil
+	}
+
+	dir := strings.TrimSuffix(event.Object, "finished.json")
+	trimmed := strings.TrimSuffix(dir, "/")
+	idx := strings.LastIndex(trimmed, "/")
+	buildID, parent := trimmed[idx+1:], trimmed[:idx+1]
+
+	newBuild := func(loc location) *types.Build {
+		build := &types.Build{
+			Job:       loc.group.Name,
+			BuildID:   buildID,
+			Scheme:    loc.scheme,
+			GCSBucket: event.Bucket,
+			GCSPrefix: dir,
+		}
+		artifacts.SetPullInfoFromPath(build)
+		return build
+	}
+
+	if loc, ok := m.flat[event.Bucket+"/"+parent]; ok {
+		return newBuild(loc)
+	}
+
+	if strings.Contains("/"+parent, "/pr-logs/pull/") {
+		job := path.Base(parent)
+		if loc, ok := m.directories[event.Bucket+"/"+job]; ok {
+			return newBuild(loc)
+		}
+		for _, loc := range m.pulls {
+			if loc.bucket != event.Bucket || loc.group.Name != job || !strings.HasPrefix(parent, loc.prefix) {
+				continue
+			}
+			// <pull-number>/<job>/
+			if strings.Count(parent[len(loc.prefix):], "/") == 2 {
+				return newBuild(loc)
+			}
+		}
+	}
+
+	return nil
+}
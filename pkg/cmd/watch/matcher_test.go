@@ -0,0 +1,170 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/notifications"
+	"github.com/dmage/triage/pkg/types"
+)
+
+func TestBuildMatcher(t *testing.T) {
+	m, err := newBuildMatcher([]config.TestGroup{
+		{Name: "periodic-e2e", GCSPrefix: "origin-ci-test/logs/periodic-e2e"},
+		{Name: "pull-ci-e2e", GCSPrefix: "gs://origin-ci-test/pr-logs/directory/pull-ci-e2e/"},
+		{Name: "pull-e2e", GCSPrefix: "gs://kubernetes-jenkins/pr-logs/pull/", Presubmit: true},
+		{Name: "job-s", GCSPrefix: "s3://ci/logs/job-s"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		event notifications.Event
+		want  *types.Build
+	}{
+		{
+			name: "periodic",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "origin-ci-test",
+				Object:    "logs/periodic-e2e/1445678901234567890/finished.json",
+			},
+			want: &types.Build{
+				Job:       "periodic-e2e",
+				BuildID:   "1445678901234567890",
+				Scheme:    types.SchemeGCS,
+				GCSBucket: "origin-ci-test",
+				GCSPrefix: "logs/periodic-e2e/1445678901234567890/",
+			},
+		},
+		{
+			name: "event without type",
+			event: notifications.Event{
+				Bucket: "ci",
+				Object: "logs/job-s/2/finished.json",
+			},
+			want: &types.Build{
+				Job:       "job-s",
+				BuildID:   "2",
+				Scheme:    types.SchemeS3,
+				GCSBucket: "ci",
+				GCSPrefix: "logs/job-s/2/",
+			},
+		},
+		{
+			name: "deleted object",
+			event: notifications.Event{
+				EventType: "OBJECT_DELETE",
+				Bucket:    "origin-ci-test",
+				Object:    "logs/periodic-e2e/1445678901234567890/finished.json",
+			},
+			want: nil,
+		},
+		{
+			name: "not finished.json",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "origin-ci-test",
+				Object:    "logs/periodic-e2e/1445678901234567890/started.json",
+			},
+			want: nil,
+		},
+		{
+			name: "finished.json in artifacts",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "origin-ci-test",
+				Object:    "logs/periodic-e2e/1445678901234567890/artifacts/finished.json",
+			},
+			want: nil,
+		},
+		{
+			name: "other bucket",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "other",
+				Object:    "logs/periodic-e2e/1445678901234567890/finished.json",
+			},
+			want: nil,
+		},
+		{
+			name: "unknown job",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "origin-ci-test",
+				Object:    "logs/periodic-unknown/1/finished.json",
+			},
+			want: nil,
+		},
+		{
+			name: "presubmit with directory links",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "origin-ci-test",
+				Object:    "pr-logs/pull/openshift_origin/42/pull-ci-e2e/7/finished.json",
+			},
+			want: &types.Build{
+				Job:        "pull-ci-e2e",
+				BuildID:    "7",
+				Scheme:     types.SchemeGCS,
+				GCSBucket:  "origin-ci-test",
+				GCSPrefix:  "pr-logs/pull/openshift_origin/42/pull-ci-e2e/7/",
+				Org:        "openshift",
+				Repo:       "origin",
+				PullNumber: 42,
+			},
+		},
+		{
+			name: "presubmit",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "kubernetes-jenkins",
+				Object:    "pr-logs/pull/42/pull-e2e/7/finished.json",
+			},
+			want: &types.Build{
+				Job:        "pull-e2e",
+				BuildID:    "7",
+				Scheme:     types.SchemeGCS,
+				GCSBucket:  "kubernetes-jenkins",
+				GCSPrefix:  "pr-logs/pull/42/pull-e2e/7/",
+				PullNumber: 42,
+			},
+		},
+		{
+			name: "presubmit of another repository",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "kubernetes-jenkins",
+				Object:    "pr-logs/pull/org_repo/42/pull-e2e/7/finished.json",
+			},
+			want: nil,
+		},
+		{
+			name: "presubmit of another job",
+			event: notifications.Event{
+				EventType: notifications.EventTypeObjectFinalize,
+				Bucket:    "kubernetes-jenkins",
+				Object:    "pr-logs/pull/42/pull-unit/7/finished.json",
+			},
+			want: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := m.Match(tc.event)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewBuildMatcherInvalidPrefix(t *testing.T) {
+	_, err := newBuildMatcher([]config.TestGroup{{Name: "job", GCSPrefix: "gs://"}})
+	if err == nil {
+		t.Error("expected an error for a test group without a bucket")
+	}
+}
@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/builddata"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/cmd/exporttriage"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/discovery"
+	"github.com/dmage/triage/pkg/kvcache"
+	"github.com/dmage/triage/pkg/notifications"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type WatchOptions struct {
+	ConfigPaths []string
+	Listen      string
+	Events      string
+	Follow      bool
+	ExportDir   string
+	Artifacts   artifacts.Options
+}
+
+func (opts *WatchOptions) source() (notifications.Source, error) {
+	switch {
+	case opts.Listen != "" && opts.Events != "":
+		return nil, fmt.Errorf("--listen and --events are mutually exclusive")
+	case opts.Listen != "":
+		return notifications.NewHTTPSource(opts.Listen), nil
+	case opts.Events != "":
+		return notifications.NewFileSource(opts.Events, opts.Follow), nil
+	default:
+		return nil, fmt.Errorf("either --listen or --events should be specified")
+	}
+}
+
+func (opts *WatchOptions) Run(ctx context.Context) error {
+	source, err := opts.source()
+	if err != nil {
+		return err
+	}
+
+	var testGroups []config.TestGroup
+	for _, path := range opts.ConfigPaths {
+		cfg, err := config.LoadFromFile(path)
+		if err != nil {
+			return err
+		}
+		testGroups = append(testGroups, cfg.TestGroups...)
+	}
+
+	matcher, err := newBuildMatcher(testGroups)
+	if err != nil {
+		return err
+	}
+
+	db, err := cache.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	client, err := opts.Artifacts.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.LogStats()
+
+	loader := builddata.NewLoader(db, client, kvcache.NewDefaultKVCache())
+	exporter, err := exporttriage.NewBuildExporter(loader)
+	if err != nil {
+		return err
+	}
+
+	err = source.Run(ctx, func(ctx context.Context, event notifications.Event) error {
+		build := matcher.Match(event)
+		if build == nil {
+			klog.V(5).Infof("Ignoring event %s for %s/%s", event.EventType, event.Bucket, event.Object)
+			return nil
+		}
+
+		klog.V(2).Infof("Build %s is finished", build)
+
+		indexed, _, err := discovery.IndexBuild(ctx, db, client, build)
+		if err != nil {
+			return err
+		}
+		if indexed == nil {
+			return nil
+		}
+
+		failures, err := exporter.Export(ctx, *indexed, opts.ExportDir)
+		if err != nil {
+			return fmt.Errorf("unable to export %s: %w", indexed, err)
+		}
+		if failures < 0 {
+			klog.V(2).Infof("%s @ %s is not finished yet", indexed.Job, indexed.BuildID)
+			return nil
+		}
+
+		klog.V(2).Infof("Exported %s @ %s: %d failures", indexed.Job, indexed.BuildID, failures)
+		return nil
+	})
+	if err != nil && ctx.Err() != nil {
+		klog.Infof("Stopped watching: %s", ctx.Err())
+		return nil
+	}
+	return err
+}
+
+func NewCmdWatch() *cobra.Command {
+	opts := &WatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "watch <testgrid.yaml>...",
+		Short: "Index and export builds as soon as they are finished",
+		Long: heredoc.Doc(`
+			Consume GCS object notifications and index builds from TestGrid
+			configuration as soon as their finished.json is written.
+
+			Every finished build is exported into --export_dir as
+			<job>/<build-id>.json with the build and its failures in the formats
+			of the builds and tests files of export-triage:
+
+			  {"build": {...}, "failures": [{...}, ...]}
+
+			Exports are overwritten if a notification is delivered again.
+
+			Notifications can be received as Pub/Sub push requests (--listen) or
+			read from a file with one JSON notification per line (--events).
+		`),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.ConfigPaths = args
+
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Listen, "listen", "", "address to listen for Pub/Sub push requests (e.g. :8081)")
+	cmd.Flags().StringVar(&opts.Events, "events", "", "file to read notifications from, - for stdin")
+	cmd.Flags().BoolVar(&opts.Follow, "follow", false, "wait for new notifications at the end of the --events file")
+	cmd.Flags().StringVar(&opts.ExportDir, "export_dir", "exports", "directory to export finished builds into")
+	opts.Artifacts.AddFlags(cmd.Flags())
+
+	return cmd
+}
@@ -10,6 +10,10 @@ import (
 type TestGroup struct {
 	GCSPrefix string `json:"gcs_prefix"`
 	Name      string `json:"name"`
+
+	// Presubmit is set for groups with the pr-logs layout, where builds are
+	// stored in <gcs_prefix>/<pull-number>/<name>/<build-id>/.
+	Presubmit bool `json:"presubmit,omitempty"`
 }
 
 type Config struct {
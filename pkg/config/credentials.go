@@ -0,0 +1,30 @@
+package config
+
+// GCSBucketCredentials configures how a GCS bucket is accessed.
+type GCSBucketCredentials struct {
+	// Bucket is the name of the bucket, or * for all buckets that are not
+	// listed explicitly.
+	Bucket string `json:"bucket"`
+
+	// CredentialsFile is a path to a service account key file. If it is
+	// empty, Application Default Credentials are used: a key file from
+	// GOOGLE_APPLICATION_CREDENTIALS, gcloud credentials, or the metadata
+	// server (Workload Identity).
+	CredentialsFile string `json:"credentials_file,omitempty"`
+
+	// Anonymous disables authentication for the bucket. It is useful to
+	// exclude public buckets from *.
+	Anonymous bool `json:"anonymous,omitempty"`
+}
+
+// GCSCredentialsConfig maps GCS buckets to credentials. Buckets that are not
+// in the config are accessed anonymously.
+type GCSCredentialsConfig struct {
+	Buckets []GCSBucketCredentials `json:"buckets"`
+}
+
+func LoadGCSCredentialsConfigFromFile(path string) (*GCSCredentialsConfig, error) {
+	config := &GCSCredentialsConfig{}
+	err := loadYAML(path, config)
+	return config, err
+}
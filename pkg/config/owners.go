@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// OwnerOverride assigns tests that don't have [sig-xxx] tags to an owner.
+type OwnerOverride struct {
+	// Pattern is a regular expression that is matched against test names.
+	Pattern string `json:"pattern"`
+
+	// Owner is the name of the team or SIG without the sig- prefix. It may
+	// contain only letters, digits, '-' and '_'.
+	Owner string `json:"owner"`
+}
+
+// OwnersConfig configures how owners of tests are determined. The first
+// matching override wins.
+type OwnersConfig struct {
+	Overrides []OwnerOverride `json:"overrides"`
+}
+
+// ownerNameRE matches owner names that can be used in the owners file.
+// Clustering turns them into names of regexp groups, with '-' replaced by
+// '_'.
+var ownerNameRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// OwnerName returns the name of owner without the sig- prefix, or an error if
+// it cannot be used in the owners file.
+func OwnerName(owner string) (string, error) {
+	name := strings.TrimPrefix(owner, "sig-")
+	if !ownerNameRE.MatchString(name) {
+		return "", fmt.Errorf("invalid owner %q: it should contain only letters, digits, '-' and '_'", owner)
+	}
+	return name, nil
+}
+
+// Validate checks that overrides have valid patterns and owners.
+func (c *OwnersConfig) Validate() error {
+	for _, o := range c.Overrides {
+		if _, err := regexp.Compile(o.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for owner %s: %w", o.Owner, err)
+		}
+		if _, err := OwnerName(o.Owner); err != nil {
+			return fmt.Errorf("pattern %q: %w", o.Pattern, err)
+		}
+	}
+	return nil
+}
+
+func LoadOwnersConfigFromFile(path string) (*OwnersConfig, error) {
+	config := &OwnersConfig{}
+	if err := loadYAML(path, config); err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
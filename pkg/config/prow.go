@@ -0,0 +1,313 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Path strategies of Prow's GCS configuration. They define how org and repo
+// of presubmits are represented in pr-logs/pull/<org_repo>/.
+const (
+	PathStrategyExplicit = "explicit"
+	PathStrategyLegacy   = "legacy"
+	PathStrategySingle   = "single"
+)
+
+type ProwGCSConfiguration struct {
+	Bucket       string `json:"bucket,omitempty"`
+	PathPrefix   string `json:"path_prefix,omitempty"`
+	PathStrategy string `json:"path_strategy,omitempty"`
+	DefaultOrg   string `json:"default_org,omitempty"`
+	DefaultRepo  string `json:"default_repo,omitempty"`
+}
+
+// merge returns a configuration where fields that are not set in c are taken
+// from defaults.
+func (c ProwGCSConfiguration) merge(defaults ProwGCSConfiguration) ProwGCSConfiguration {
+	if c.Bucket == "" {
+		c.Bucket = defaults.Bucket
+	}
+	if c.PathPrefix == "" {
+		c.PathPrefix = defaults.PathPrefix
+	}
+	if c.PathStrategy == "" {
+		c.PathStrategy = defaults.PathStrategy
+	}
+	if c.DefaultOrg == "" {
+		c.DefaultOrg = defaults.DefaultOrg
+	}
+	if c.DefaultRepo == "" {
+		c.DefaultRepo = defaults.DefaultRepo
+	}
+	return c
+}
+
+type ProwDecorationConfig struct {
+	GCSConfiguration *ProwGCSConfiguration `json:"gcs_configuration,omitempty"`
+}
+
+type ProwRef struct {
+	Org  string `json:"org"`
+	Repo string `json:"repo"`
+}
+
+type ProwJob struct {
+	Name             string                `json:"name"`
+	Decorate         *bool                 `json:"decorate,omitempty"`
+	DecorationConfig *ProwDecorationConfig `json:"decoration_config,omitempty"`
+	ExtraRefs        []ProwRef             `json:"extra_refs,omitempty"`
+}
+
+// ProwJobConfig is the subset of Prow's job configuration that is needed to
+// find artifacts of jobs.
+type ProwJobConfig struct {
+	Periodics   []ProwJob            `json:"periodics,omitempty"`
+	Presubmits  map[string][]ProwJob `json:"presubmits,omitempty"`
+	Postsubmits map[string][]ProwJob `json:"postsubmits,omitempty"`
+}
+
+type ProwDecorationConfigEntry struct {
+	Repo   string                `json:"repo,omitempty"`
+	Config *ProwDecorationConfig `json:"config,omitempty"`
+}
+
+// ProwConfig is the subset of Prow's main configuration that provides
+// defaults for jobs.
+type ProwConfig struct {
+	Plank struct {
+		DefaultDecorationConfigs       map[string]*ProwDecorationConfig `json:"default_decoration_configs,omitempty"`
+		DefaultDecorationConfigEntries []ProwDecorationConfigEntry      `json:"default_decoration_config_entries,omitempty"`
+	} `json:"plank"`
+	DecorateAllJobs bool `json:"decorate_all_jobs,omitempty"`
+}
+
+func loadYAML(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	err = yaml.Unmarshal(buf, v)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func LoadProwConfigFromFile(path string) (*ProwConfig, error) {
+	config := &ProwConfig{}
+	err := loadYAML(path, config)
+	return config, err
+}
+
+// LoadProwJobConfig loads job configuration from files. Directories are
+// walked recursively and all *.yaml and *.yml files in them are loaded.
+func LoadProwJobConfig(paths []string) (*ProwJobConfig, error) {
+	config := &ProwJobConfig{
+		Presubmits:  make(map[string][]ProwJob),
+		Postsubmits: make(map[string][]ProwJob),
+	}
+	load := func(path string) error {
+		var c ProwJobConfig
+		if err := loadYAML(path, &c); err != nil {
+			return err
+		}
+		config.Periodics = append(config.Periodics, c.Periodics...)
+		for repo, jobs := range c.Presubmits {
+			config.Presubmits[repo] = append(config.Presubmits[repo], jobs...)
+		}
+		for repo, jobs := range c.Postsubmits {
+			config.Postsubmits[repo] = append(config.Postsubmits[repo], jobs...)
+		}
+		return nil
+	}
+	for _, p := range paths {
+		err := filepath.Walk(p, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if filename != p && !strings.HasSuffix(filename, ".yaml") && !strings.HasSuffix(filename, ".yml") {
+				return nil
+			}
+			return load(filename)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// gcsConfiguration returns the effective GCS configuration for a job from
+// the repository orgRepo (org/repo, or empty for periodics without refs).
+func (c *ProwConfig) gcsConfiguration(job ProwJob, orgRepo string) ProwGCSConfiguration {
+	var gcs ProwGCSConfiguration
+	if job.DecorationConfig != nil && job.DecorationConfig.GCSConfiguration != nil {
+		gcs = *job.DecorationConfig.GCSConfiguration
+	}
+
+	org := strings.SplitN(orgRepo, "/", 2)[0]
+
+	// Apply defaults from the most specific to the least specific.
+	lookup := func(key string) {
+		if d := c.Plank.DefaultDecorationConfigs[key]; d != nil && d.GCSConfiguration != nil {
+			gcs = gcs.merge(*d.GCSConfiguration)
+		}
+		for i := len(c.Plank.DefaultDecorationConfigEntries) - 1; i >= 0; i-- {
+			entry := c.Plank.DefaultDecorationConfigEntries[i]
+			repo := entry.Repo
+			if repo == "" {
+				repo = "*"
+			}
+			if repo == key && entry.Config != nil && entry.Config.GCSConfiguration != nil {
+				gcs = gcs.merge(*entry.Config.GCSConfiguration)
+			}
+		}
+	}
+	if orgRepo != "" {
+		lookup(orgRepo)
+		lookup(org)
+	}
+	lookup("*")
+
+	return gcs
+}
+
+func (c *ProwConfig) isDecorated(job ProwJob) bool {
+	if job.Decorate != nil {
+		return *job.Decorate
+	}
+	return c.DecorateAllJobs
+}
+
+// repoPathSegment returns the <org_repo> part of pr-logs/pull/<org_repo>/ for
+// the path strategy of gcs.
+func repoPathSegment(gcs ProwGCSConfiguration, org, repo string) string {
+	switch gcs.PathStrategy {
+	case PathStrategyLegacy:
+		if org == gcs.DefaultOrg {
+			if repo == gcs.DefaultRepo {
+				return ""
+			}
+			return repo
+		}
+	case PathStrategySingle:
+		if org == gcs.DefaultOrg && repo == gcs.DefaultRepo {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s_%s", org, repo)
+}
+
+// location returns the location of dir in the bucket from gcs. Buckets may
+// have a scheme (gs://, s3://), buckets without a scheme are GCS buckets.
+func location(gcs ProwGCSConfiguration, dir ...string) string {
+	bucket := strings.TrimPrefix(gcs.Bucket, "gs://")
+	return strings.TrimSuffix(bucket, "/") + "/" + path.Join(append([]string{gcs.PathPrefix}, dir...)...) + "/"
+}
+
+// TestGroups derives test groups for decorated jobs from jobs. Jobs without a
+// GCS bucket in their decoration config are skipped and their names are
+// returned in skipped.
+//
+// Builds of presubmits are found using links from pr-logs/directory/<job>/,
+// or, if pullLayout is set, by scanning all pull requests in
+// pr-logs/pull/<org_repo>/.
+func (c *ProwConfig) TestGroups(jobs *ProwJobConfig, pullLayout bool) (testGroups []TestGroup, skipped []string) {
+	add := func(job ProwJob, orgRepo string, f func(gcs ProwGCSConfiguration) []TestGroup) {
+		if !c.isDecorated(job) {
+			skipped = append(skipped, job.Name)
+			return
+		}
+		gcs := c.gcsConfiguration(job, orgRepo)
+		if gcs.Bucket == "" {
+			skipped = append(skipped, job.Name)
+			return
+		}
+		testGroups = append(testGroups, f(gcs)...)
+	}
+
+	for _, job := range jobs.Periodics {
+		orgRepo := ""
+		if len(job.ExtraRefs) > 0 {
+			orgRepo = job.ExtraRefs[0].Org + "/" + job.ExtraRefs[0].Repo
+		}
+		add(job, orgRepo, func(gcs ProwGCSConfiguration) []TestGroup {
+			return []TestGroup{{
+				Name:      job.Name,
+				GCSPrefix: location(gcs, "logs", job.Name),
+			}}
+		})
+	}
+
+	for _, orgRepo := range sortedKeys(jobs.Postsubmits) {
+		for _, job := range jobs.Postsubmits[orgRepo] {
+			add(job, orgRepo, func(gcs ProwGCSConfiguration) []TestGroup {
+				return []TestGroup{{
+					Name:      job.Name,
+					GCSPrefix: location(gcs, "logs", job.Name),
+				}}
+			})
+		}
+	}
+
+	for _, orgRepo := range sortedKeys(jobs.Presubmits) {
+		parts := strings.SplitN(orgRepo, "/", 2)
+		if len(parts) != 2 {
+			for _, job := range jobs.Presubmits[orgRepo] {
+				skipped = append(skipped, job.Name)
+			}
+			continue
+		}
+		org, repo := parts[0], parts[1]
+		for _, job := range jobs.Presubmits[orgRepo] {
+			add(job, orgRepo, func(gcs ProwGCSConfiguration) []TestGroup {
+				if !pullLayout {
+					// Links to presubmit and batch builds.
+					return []TestGroup{{
+						Name:      job.Name,
+						GCSPrefix: location(gcs, "pr-logs", "directory", job.Name),
+					}}
+				}
+				return []TestGroup{
+					{
+						Name:      job.Name,
+						GCSPrefix: location(gcs, "pr-logs", "pull", repoPathSegment(gcs, org, repo)),
+						Presubmit: true,
+					},
+					{
+						Name:      job.Name,
+						GCSPrefix: location(gcs, "pr-logs", "pull", "batch", job.Name),
+					},
+				}
+			})
+		}
+	}
+
+	return testGroups, skipped
+}
+
+func sortedKeys(m map[string][]ProwJob) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
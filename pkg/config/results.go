@@ -0,0 +1,48 @@
+package config
+
+// ResultFile is a file of a build that contains test results.
+type ResultFile struct {
+	// Pattern is a regular expression that is matched against object names
+	// of build artifacts.
+	Pattern string `json:"pattern"`
+
+	// Format is the format of the file: junit, ginkgo (Ginkgo v2 JSON
+	// report) or gotest (output of go test -json).
+	Format string `json:"format"`
+}
+
+// JobResults declares which files of builds of matching jobs contain test
+// results.
+type JobResults struct {
+	// Job is a regular expression that is matched against job names. An
+	// empty pattern matches all jobs.
+	Job string `json:"job,omitempty"`
+
+	Files []ResultFile `json:"files"`
+}
+
+// ResultsConfig configures where test results of builds are read from. The
+// first matching entry wins. Builds of jobs without a matching entry are read
+// from junit files (/junit.*\.xml$). Changes don't affect builds that are
+// already cached. For example:
+//
+//	jobs:
+//	- job: "^periodic-.*-e2e-"
+//	  files:
+//	  - pattern: '/report\.json$'
+//	    format: ginkgo
+//	  - pattern: '/junit_upgrade.*\.xml$'
+//	    format: junit
+//	- job: "^pull-.*-unit$"
+//	  files:
+//	  - pattern: '/go-test.*\.json$'
+//	    format: gotest
+type ResultsConfig struct {
+	Jobs []JobResults `json:"jobs"`
+}
+
+func LoadResultsConfigFromFile(path string) (*ResultsConfig, error) {
+	config := &ResultsConfig{}
+	err := loadYAML(path, config)
+	return config, err
+}
@@ -0,0 +1,23 @@
+package config
+
+// NormalizationRule rewrites parts of test names.
+type NormalizationRule struct {
+	// Pattern is a regular expression that is matched against test names.
+	Pattern string `json:"pattern"`
+
+	// Replacement replaces matches of Pattern. It can refer to submatches
+	// as $1 or ${name}.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// NormalizationConfig is an ordered list of rules that normalize test names,
+// so that names of one test that differ between builds are grouped together.
+type NormalizationConfig struct {
+	Rules []NormalizationRule `json:"rules"`
+}
+
+func LoadNormalizationConfigFromFile(path string) (*NormalizationConfig, error) {
+	config := &NormalizationConfig{}
+	err := loadYAML(path, config)
+	return config, err
+}
@@ -0,0 +1,271 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// Options configures how builds of test groups are discovered and indexed.
+type Options struct {
+	NumWorkers int
+
+	// CreatedAfter stops discovery of a test group at the first build that
+	// was started before this Unix time. Zero means no limit.
+	CreatedAfter int64
+
+	// FullListing disables the use of the last build IDs that are saved for
+	// test groups, so all their builds are listed.
+	FullListing bool
+
+	// Retries is the number of times discovery of a test group is retried
+	// after a failure.
+	Retries int
+
+	// MaxFailedGroups is the number of test groups that may fail without
+	// failing the run. A negative value means no limit.
+	MaxFailedGroups int
+}
+
+// retryDelay is the delay before the first retry. It doubles after each
+// attempt.
+var retryDelay = 5 * time.Second
+
+// lastBuildMargin is how long builds are listed again after newer builds are
+// started. Builds may appear or get their started.json after newer ones, for
+// example when runs of a job overlap or wait for resources.
+var lastBuildMargin = 24 * time.Hour
+
+// lastBuildID returns the ID of the build that was saved for testGroup during
+// previous runs. Older builds have been discovered and don't need to be
+// listed again.
+func (opts *Options) lastBuildID(db *cache.Storage, testGroup config.TestGroup) (string, error) {
+	if opts.FullListing || testGroup.Presubmit {
+		return "", nil
+	}
+	buildID, err := db.LoadLastBuildID(testGroup.Name, testGroup.GCSPrefix)
+	if cache.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to load last build ID for %s: %w", testGroup.Name, err)
+	}
+	return buildID, nil
+}
+
+func (opts *Options) findBuilds(ctx context.Context, client *artifacts.Client, testGroup config.TestGroup, since string) ([]*types.Build, error) {
+	if testGroup.Presubmit {
+		return client.FindPullBuilds(ctx, testGroup.Name, testGroup.GCSPrefix)
+	}
+	return client.FindBuilds(ctx, testGroup.Name, testGroup.GCSPrefix, since)
+}
+
+// IndexBuild saves build into db if it is not there yet. It returns the
+// indexed build and its start time. If the build cannot be indexed (for
+// example, it does not have started.json yet), nil is returned.
+func IndexBuild(ctx context.Context, db *cache.Storage, client *artifacts.Client, build *types.Build) (*types.Build, int64, error) {
+	indexed, startedAt, err := db.LoadBuild(build.Job, build.BuildID)
+	if err == nil {
+		return indexed, startedAt, nil
+	} else if !cache.IsNotFound(err) {
+		return nil, 0, fmt.Errorf("unable to load build from cache: %w", err)
+	}
+
+	klog.V(3).Infof("Discovered new build: %s @ %s", build.Job, build.BuildID)
+
+	err = client.ResolveBuild(ctx, build)
+	if artifacts.IsNotFound(err) {
+		klog.V(3).Infof("%s @ %s has a dangling link, skipping...", build.Job, build.BuildID)
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("unable to resolve build location: %w", err)
+	}
+
+	started, err := client.GetStartedJson(ctx, build)
+	if artifacts.IsNotFound(err) {
+		klog.V(3).Infof("%s @ %s does not have started.json, skipping...", build.Job, build.BuildID)
+		return nil, 0, nil
+	} else if artifacts.IsInvalidJSON(err) {
+		klog.V(3).Infof("%s @ %s has invalid started.json: %s", build.Job, build.BuildID, err)
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("unable to get started.json: %w", err)
+	}
+
+	var prowJob *artifacts.ProwJobJson
+	if j, err := client.GetProwJobJson(ctx, build); err == nil {
+		prowJob = &j
+	} else if artifacts.IsNotFound(err) || artifacts.IsInvalidJSON(err) {
+		klog.V(4).Infof("%s @ %s does not have usable prowjob.json: %s", build.Job, build.BuildID, err)
+	} else {
+		return nil, 0, fmt.Errorf("unable to get prowjob.json: %w", err)
+	}
+
+	artifacts.SetBuildMetadata(build, started, prowJob)
+
+	err = db.SaveBuild(build, started.Timestamp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to save build: %w", err)
+	}
+
+	return build, started.Timestamp, nil
+}
+
+func (opts *Options) discoverTestGroup(ctx context.Context, db *cache.Storage, client *artifacts.Client, testGroup config.TestGroup) error {
+	since, err := opts.lastBuildID(db, testGroup)
+	if err != nil {
+		return err
+	}
+
+	builds, err := opts.findBuilds(ctx, client, testGroup, since)
+	if err != nil {
+		return fmt.Errorf("unable to find builds: %w", err)
+	}
+
+	for i, j := 0, len(builds)-1; i < j; i, j = i+1, j-1 {
+		builds[i], builds[j] = builds[j], builds[i]
+	}
+
+	// Builds that were started within lastBuildMargin of the newest build are
+	// listed again by the next runs, so are builds between them that are
+	// skipped now (for example, they don't have started.json yet).
+	var (
+		lastBuildID     string
+		newestStartedAt int64
+	)
+	for _, build := range builds {
+		indexed, startedAt, err := IndexBuild(ctx, db, client, build)
+		if err != nil {
+			return fmt.Errorf("unable to index build %s: %w", build.BuildID, err)
+		}
+		if indexed == nil {
+			continue
+		}
+
+		if newestStartedAt == 0 {
+			newestStartedAt = startedAt
+		}
+		if lastBuildID == "" && startedAt <= newestStartedAt-int64(lastBuildMargin/time.Second) {
+			lastBuildID = build.BuildID
+		}
+
+		if opts.CreatedAfter != 0 && startedAt < opts.CreatedAfter {
+			break
+		}
+	}
+
+	if !testGroup.Presubmit && lastBuildID != "" && lastBuildID != since {
+		err := db.SaveLastBuildID(testGroup.Name, testGroup.GCSPrefix, lastBuildID)
+		if err != nil {
+			return fmt.Errorf("unable to save last build ID: %w", err)
+		}
+	}
+	return nil
+}
+
+// discoverTestGroupWithRetries discovers builds of testGroup and retries
+// failed attempts. Builds that were indexed before a failure are not indexed
+// again, so retries are cheap.
+func (opts *Options) discoverTestGroupWithRetries(ctx context.Context, db *cache.Storage, client *artifacts.Client, testGroup config.TestGroup) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := opts.discoverTestGroup(ctx, db, client, testGroup)
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		klog.Warningf("Failed to discover builds for %s (%s), retrying in %s: %s", testGroup.Name, testGroup.GCSPrefix, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// FailedTestGroup is a test group that could not be discovered.
+type FailedTestGroup struct {
+	TestGroup config.TestGroup
+	Err       error
+}
+
+func (opts *Options) worker(ctx context.Context, db *cache.Storage, client *artifacts.Client, testGroups <-chan config.TestGroup, failures chan<- FailedTestGroup) {
+	for testGroup := range testGroups {
+		err := opts.discoverTestGroupWithRetries(ctx, db, client, testGroup)
+		if err != nil {
+			failures <- FailedTestGroup{
+				TestGroup: testGroup,
+				Err:       err,
+			}
+		}
+	}
+}
+
+// Run discovers new builds of testGroups and saves them into db. A failure of
+// one test group doesn't stop discovery of other groups. Failed groups are
+// reported at the end, and an error is returned if there are more than
+// MaxFailedGroups of them.
+func (opts *Options) Run(ctx context.Context, db *cache.Storage, client *artifacts.Client, testGroups []config.TestGroup) error {
+	inputs := make(chan config.TestGroup)
+	failures := make(chan FailedTestGroup)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.NumWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts.worker(ctx, db, client, inputs, failures)
+		}()
+	}
+
+	go func() {
+		defer close(inputs)
+		for _, testGroup := range testGroups {
+			select {
+			case <-ctx.Done():
+				return
+			case inputs <- testGroup:
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(failures)
+	}()
+
+	var failed []FailedTestGroup
+	for f := range failures {
+		failed = append(failed, f)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(failed) == 0 {
+		klog.V(2).Infof("Discovered builds for %d test groups", len(testGroups))
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].TestGroup.Name < failed[j].TestGroup.Name
+	})
+	klog.Warningf("Failed to discover builds for %d of %d test groups:", len(failed), len(testGroups))
+	for _, f := range failed {
+		klog.Warningf("  %s (%s): %s", f.TestGroup.Name, f.TestGroup.GCSPrefix, f.Err)
+	}
+
+	if opts.MaxFailedGroups >= 0 && len(failed) > opts.MaxFailedGroups {
+		return fmt.Errorf("failed to discover builds for %d of %d test groups", len(failed), len(testGroups))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmage/triage/pkg/artifacts"
+	"github.com/dmage/triage/pkg/cache"
+	"github.com/dmage/triage/pkg/config"
+	"github.com/dmage/triage/pkg/types"
+)
+
+// newTestEnv creates a cache in a temporary working directory and a client
+// that reads builds from its mirror directory.
+func newTestEnv(t *testing.T) (*cache.Storage, *artifacts.Client, string) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := os.Mkdir("cache", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := cache.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mirror := filepath.Join(dir, "mirror")
+	client := artifacts.NewClient(map[string]artifacts.Store{
+		types.SchemeFile: artifacts.NewFileStore(mirror),
+	})
+	return db, client, filepath.Join(mirror, "ci", "logs", "job")
+}
+
+func writeBuild(t *testing.T, jobDir, buildID string, startedAt *time.Time) {
+	buildDir := filepath.Join(jobDir, buildID)
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if startedAt == nil {
+		// The build directory is created before started.json is uploaded.
+		if err := ioutil.WriteFile(filepath.Join(buildDir, "podinfo.json"), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	started := fmt.Sprintf(`{"timestamp": %d}`, startedAt.Unix())
+	if err := ioutil.WriteFile(filepath.Join(buildDir, "started.json"), []byte(started), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverTestGroupLastBuildID(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	testCases := []struct {
+		name   string
+		builds map[string]*time.Time
+		want   string
+	}{
+		{
+			name: "recent builds",
+			builds: map[string]*time.Time{
+				"1": ago(time.Hour),
+				"2": ago(0),
+			},
+			want: "",
+		},
+		{
+			name: "builds older than the margin",
+			builds: map[string]*time.Time{
+				"1": ago(48 * time.Hour),
+				"2": ago(30 * time.Hour),
+				"3": ago(time.Hour),
+				"4": ago(0),
+			},
+			want: "2",
+		},
+		{
+			name: "build without started.json",
+			builds: map[string]*time.Time{
+				"1": ago(48 * time.Hour),
+				"2": ago(30 * time.Hour),
+				"3": nil,
+				"4": ago(0),
+			},
+			want: "2",
+		},
+		{
+			name: "build IDs gain a digit",
+			builds: map[string]*time.Time{
+				"9":  ago(48 * time.Hour),
+				"10": ago(0),
+			},
+			want: "9",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, client, jobDir := newTestEnv(t)
+			for buildID, startedAt := range tc.builds {
+				writeBuild(t, jobDir, buildID, startedAt)
+			}
+
+			testGroup := config.TestGroup{Name: "job", GCSPrefix: "file://ci/logs/job"}
+			opts := &Options{}
+			if err := opts.discoverTestGroup(context.Background(), db, client, testGroup); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := db.LoadLastBuildID(testGroup.Name, testGroup.GCSPrefix)
+			if cache.IsNotFound(err) {
+				got = ""
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("last build ID: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverTestGroupLateBuilds(t *testing.T) {
+	db, client, jobDir := newTestEnv(t)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	writeBuild(t, jobDir, "1", &old)
+	writeBuild(t, jobDir, "2", nil)
+	writeBuild(t, jobDir, "4", &now)
+
+	testGroup := config.TestGroup{Name: "job", GCSPrefix: "file://ci/logs/job"}
+	opts := &Options{}
+	if err := opts.discoverTestGroup(context.Background(), db, client, testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build 2 gets started.json, and build 3 appears after the newer build 4.
+	later := now.Add(time.Minute)
+	writeBuild(t, jobDir, "2", &later)
+	writeBuild(t, jobDir, "3", &later)
+	if err := opts.discoverTestGroup(context.Background(), db, client, testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, buildID := range []string{"1", "2", "3", "4"} {
+		if _, _, err := db.LoadBuild("job", buildID); err != nil {
+			t.Errorf("build %s is not indexed: %v", buildID, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/dmage/triage/pkg/atomicfile"
+	"k8s.io/klog/v2"
+)
+
+// dateLayout is the layout of dates in names of snapshots. The dashboard
+// requests snapshots as history/YYYYMMDD.json.
+const dateLayout = "20060102"
+
+var nameRe = regexp.MustCompile(`^([0-9]{8})\.json$`)
+
+// Name returns the name of the snapshot for the day of t in UTC.
+func Name(t time.Time) string {
+	return t.UTC().Format(dateLayout) + ".json"
+}
+
+// IsValidName reports whether name is a name of a snapshot.
+func IsValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// Save copies src into dir as the snapshot for the day of t. A snapshot that
+// was saved earlier on the same day is replaced.
+func Save(dir string, t time.Time, src string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	path := filepath.Join(dir, Name(t))
+	out, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("unable to copy %s to %s: %w", src, path, err)
+	}
+	return out.Commit()
+}
+
+// Prune removes snapshots for days that are older than retention.
+func Prune(dir string, now time.Time, retention time.Duration) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cutoff := now.UTC().Add(-retention).Format(dateLayout)
+	for _, e := range entries {
+		m := nameRe.FindStringSubmatch(e.Name())
+		if m == nil || m[1] >= cutoff {
+			continue
+		}
+		klog.V(2).Infof("Removing history snapshot %s...", e.Name())
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
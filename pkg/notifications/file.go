@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type fileSource struct {
+	path   string
+	follow bool
+}
+
+// NewFileSource returns a source that reads events from a file with one JSON
+// notification per line. If path is "-", events are read from stdin. If follow
+// is set, the source waits for new lines at the end of the file.
+func NewFileSource(path string, follow bool) Source {
+	return &fileSource{
+		path:   path,
+		follow: follow,
+	}
+}
+
+func (s *fileSource) Run(ctx context.Context, handle Handler) error {
+	var r io.Reader
+	if s.path == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, err := br.ReadBytes('\n')
+		line = append(line, chunk...)
+		if err == io.EOF && s.follow {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+
+		if buf := bytes.TrimSpace(line); len(buf) > 0 {
+			event, parseErr := ParseEvent(buf)
+			if parseErr != nil {
+				klog.Warningf("Skipping invalid event: %s", parseErr)
+			} else if handleErr := handle(ctx, event); handleErr != nil {
+				klog.Errorf("Unable to handle event for %s/%s: %s", event.Bucket, event.Object, handleErr)
+			}
+		}
+		line = line[:0]
+
+		if err == io.EOF {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type httpSource struct {
+	addr string
+}
+
+// NewHTTPSource returns a source that receives events as Pub/Sub push
+// requests (or bare GCS object resources) POSTed to addr. A request is
+// acknowledged only after the event has been handled, so Pub/Sub redelivers
+// events that failed.
+func NewHTTPSource(addr string) Source {
+	return &httpSource{
+		addr: addr,
+	}
+}
+
+func (s *httpSource) Run(ctx context.Context, handle Handler) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		buf, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		event, err := ParseEvent(buf)
+		if err != nil {
+			// Redelivery won't help, acknowledge the message.
+			klog.Warningf("Skipping invalid event: %s", err)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		err = handle(r.Context(), event)
+		if err != nil {
+			klog.Errorf("Unable to handle event for %s/%s: %s", event.Bucket, event.Object, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := &http.Server{
+		Addr:    s.addr,
+		Handler: mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		klog.Infof("Listening for notifications on %s...", s.addr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx) // Best effort
+		return ctx.Err()
+	}
+}
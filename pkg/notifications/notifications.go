@@ -0,0 +1,87 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// EventTypeObjectFinalize is the type of notifications about new objects.
+const EventTypeObjectFinalize = "OBJECT_FINALIZE"
+
+// Event is a notification about a change of an object in a bucket.
+type Event struct {
+	EventType string
+	Bucket    string
+	Object    string
+}
+
+// Handler processes an event. If it returns an error, the source may deliver
+// the event again.
+type Handler func(ctx context.Context, event Event) error
+
+// Source delivers object notifications.
+type Source interface {
+	// Run calls handle for received events until ctx is canceled or the
+	// source is exhausted.
+	Run(ctx context.Context, handle Handler) error
+}
+
+// pubsubPushRequest is the body of a Pub/Sub push request.
+type pubsubPushRequest struct {
+	Message struct {
+		Attributes map[string]string `json:"attributes"`
+		Data       []byte            `json:"data"`
+		MessageID  string            `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// objectResource is the JSON_API_V1 payload of GCS notifications.
+type objectResource struct {
+	Kind   string `json:"kind"`
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+}
+
+// ParseEvent parses an event from a Pub/Sub push request that carries a GCS
+// notification, or from a bare GCS object resource (in which case the event
+// type is OBJECT_FINALIZE).
+func ParseEvent(buf []byte) (Event, error) {
+	var push pubsubPushRequest
+	if err := json.Unmarshal(buf, &push); err != nil {
+		return Event{}, fmt.Errorf("unable to decode notification: %w", err)
+	}
+
+	if attrs := push.Message.Attributes; attrs != nil {
+		event := Event{
+			EventType: attrs["eventType"],
+			Bucket:    attrs["bucketId"],
+			Object:    attrs["objectId"],
+		}
+		if event.Bucket == "" || event.Object == "" {
+			// Fall back to the payload, if the subscription has it.
+			var obj objectResource
+			if err := json.Unmarshal(push.Message.Data, &obj); err == nil {
+				event.Bucket, event.Object = obj.Bucket, obj.Name
+			}
+		}
+		if event.Bucket == "" || event.Object == "" {
+			return Event{}, fmt.Errorf("notification %s does not have bucketId and objectId", push.Message.MessageID)
+		}
+		return event, nil
+	}
+
+	var obj objectResource
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return Event{}, fmt.Errorf("unable to decode notification: %w", err)
+	}
+	if obj.Bucket == "" || obj.Name == "" {
+		return Event{}, fmt.Errorf("notification does not have bucket and name")
+	}
+	return Event{
+		EventType: EventTypeObjectFinalize,
+		Bucket:    obj.Bucket,
+		Object:    obj.Name,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package summarize
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/dmage/triage/pkg/types"
+)
+
+// AssignmentStore persists cluster assignments of test failures between runs.
+type AssignmentStore interface {
+	LoadClusterAssignments() ([]types.ClusterAssignment, error)
+	SaveClusterAssignments(assignments []types.ClusterAssignment) error
+}
+
+type assignmentKey struct {
+	build   string
+	test    string
+	failure string
+}
+
+// failureHash identifies a failure among other failures of the same test in one build. Failures
+// with the same text end up in the same cluster anyway, so they don't need to be told apart.
+func failureHash(f failure) string {
+	sum := sha1.Sum([]byte(f.FailureText))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitAssigned separates failures that have assignments from new ones. Failures are identified by
+// their build, test and failure text.
+func splitAssigned(failuresByTest failuresGroup, assignments []types.ClusterAssignment) (assigned nestedFailuresGroups, unassigned failuresGroup) {
+	clusterOf := make(map[assignmentKey]string, len(assignments))
+	for _, a := range assignments {
+		clusterOf[assignmentKey{build: a.Build, test: a.Test, failure: a.Failure}] = a.Cluster
+	}
+
+	assigned = make(nestedFailuresGroups)
+	unassigned = make(failuresGroup)
+	for testName, failures := range failuresByTest {
+		for _, f := range failures {
+			cluster, ok := clusterOf[assignmentKey{build: f.Build, test: testName, failure: failureHash(f)}]
+			if !ok {
+				unassigned[testName] = append(unassigned[testName], f)
+				continue
+			}
+			if _, ok := assigned[cluster]; !ok {
+				assigned[cluster] = make(failuresGroup)
+			}
+			assigned[cluster][testName] = append(assigned[cluster][testName], f)
+		}
+	}
+	return assigned, unassigned
+}
+
+// collectAssignments returns the cluster assignments of all clustered failures.
+func collectAssignments(clustered nestedFailuresGroups) []types.ClusterAssignment {
+	var assignments []types.ClusterAssignment
+	for cluster, tests := range clustered {
+		for testName, failures := range tests {
+			for _, f := range failures {
+				assignments = append(assignments, types.ClusterAssignment{
+					Build:   f.Build,
+					Test:    testName,
+					Failure: failureHash(f),
+					Cluster: cluster,
+				})
+			}
+		}
+	}
+	return assignments
+}
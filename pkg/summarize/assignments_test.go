@@ -0,0 +1,29 @@
+package summarize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAssignedRepeatedFailures(t *testing.T) {
+	timeout := failure{Build: "logs/job/1", Name: "test", FailureText: "timed out"}
+	panicked := failure{Build: "logs/job/1", Name: "test", FailureText: "panic: nil pointer"}
+	other := failure{Build: "logs/job/2", Name: "test", FailureText: "connection refused"}
+
+	clustered := nestedFailuresGroups{
+		"timed out":          {"test": {timeout}},
+		"panic: nil pointer": {"test": {panicked}},
+	}
+	assignments := collectAssignments(clustered)
+	if len(assignments) != 2 {
+		t.Fatalf("got %d assignments, want 2", len(assignments))
+	}
+
+	assigned, unassigned := splitAssigned(failuresGroup{"test": {timeout, panicked, other}}, assignments)
+	if !reflect.DeepEqual(assigned, clustered) {
+		t.Errorf("assigned: got %v, want %v", assigned, clustered)
+	}
+	if want := (failuresGroup{"test": {other}}); !reflect.DeepEqual(unassigned, want) {
+		t.Errorf("unassigned: got %v, want %v", unassigned, want)
+	}
+}
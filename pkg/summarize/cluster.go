@@ -34,9 +34,6 @@ by the test they belong to. These groups are subdivided into clusters.
 numWorkers determines how many goroutines to spawn to simultaneously process the failure
 groups. If numWorkers <= 0, the value is set to 1.
 
-memoize determines if memoized results should attempt to be retrieved, and if new results should be
-memoized to JSON.
-
 Takes:
     {
 		testName1: [failure1, failure2, failure3, failure4, ...],
@@ -60,17 +57,9 @@ Returns:
 		...
 	}
 */
-func clusterLocal(failuresByTest failuresGroup, numWorkers int, memoize bool) nestedFailuresGroups {
-	const memoPath string = "memo_cluster_local.json"
-	const memoMessage string = "clustering inside each test"
-
+func clusterLocal(failuresByTest failuresGroup, numWorkers int) nestedFailuresGroups {
 	clustered := make(nestedFailuresGroups)
 
-	// Try to retrieve memoized results first to avoid another computation
-	if memoize && getMemoizedResults(memoPath, memoMessage, &clustered) {
-		return clustered
-	}
-
 	numFailures := 0 // The number of failures processed so far
 	start := time.Now()
 	klog.V(2).Infof("Clustering failures for %d unique tests...", len(failuresByTest))
@@ -147,10 +136,6 @@ func clusterLocal(failuresByTest failuresGroup, numWorkers int, memoize bool) ne
 	elapsed := time.Since(start)
 	klog.V(2).Infof("Finished locally clustering %d unique tests (%d failures) in %s", len(clustered), numFailures, elapsed.String())
 
-	// Memoize the results
-	if memoize {
-		memoizeResults(memoPath, memoMessage, clustered)
-	}
 	return clustered
 }
 
@@ -172,8 +157,9 @@ reducing the number of clusters that need to be paired up at this stage.
 
 previouslyClustered can be nil when there aren't previous results to use.
 
-memoize determines if memoized results should attempt to be retrieved, and if new results should be
-memoized to JSON.
+assigned are failures that have been put into clusters by a previous run, grouped by cluster
+text and then by test. They are kept in their clusters, and newly clustered failures can be
+merged into these clusters. assigned can be nil.
 
 Takes:
 	{
@@ -210,18 +196,10 @@ Returns:
 		...
 	}
 */
-func clusterGlobal(newlyClustered nestedFailuresGroups, previouslyClustered []jsonCluster, memoize bool) nestedFailuresGroups {
-	const memoPath string = "memo_cluster_global.json"
-	const memoMessage string = "clustering across tests"
-
+func clusterGlobal(newlyClustered nestedFailuresGroups, previouslyClustered []jsonCluster, assigned nestedFailuresGroups) nestedFailuresGroups {
 	// The eventual global clusters
 	clusters := make(nestedFailuresGroups)
 
-	// Try to retrieve memoized results first to avoid another computation
-	if memoize && getMemoizedResults(memoPath, memoMessage, &clusters) {
-		return clusters
-	}
-
 	numFailures := 0
 
 	klog.V(2).Infof("Combining clustered failures for %d unique tests...", len(newlyClustered))
@@ -250,6 +228,21 @@ func clusterGlobal(newlyClustered nestedFailuresGroups, previouslyClustered []js
 		}
 	}
 
+	if assigned != nil {
+		numAssigned := 0
+		for key, tests := range assigned {
+			if _, ok := clusters[key]; !ok {
+				clusters[key] = make(failuresGroup)
+			}
+			for testName, failures := range tests {
+				clusters[key][testName] = append(clusters[key][testName], failures...)
+				numAssigned += len(failures)
+			}
+		}
+
+		klog.V(2).Infof("Seeding with %d previously assigned failures", numAssigned)
+	}
+
 	// Look at tests with the most failures over all clusters first
 	for n, outerPair := range newlyClustered.sortByMostAggregatedFailures() {
 		testName := outerPair.Key
@@ -322,10 +315,6 @@ func clusterGlobal(newlyClustered nestedFailuresGroups, previouslyClustered []js
 	klog.V(2).Infof("Finished clustering %d unique tests (%d failures) into %d clusters in %s",
 		len(newlyClustered), numFailures, len(clusters), elapsed.String())
 
-	// Memoize the results
-	if memoize {
-		memoizeResults(memoPath, memoMessage, clusters)
-	}
 	return clusters
 }
 
@@ -16,8 +16,8 @@ limitations under the License.
 
 /*
 Contains functions that manage the reading and writing of files related to package summarize.
-This includes reading and interpreting JSON files as actionable data, memoizing function
-results to JSON, and outputting results once the summarization process is complete.
+This includes reading and interpreting JSON files as actionable data, and outputting results
+once the summarization process is complete.
 */
 
 package summarize
@@ -28,28 +28,29 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"sort"
 	"strconv"
-	"strings"
 
-	"k8s.io/klog/v2"
+	"github.com/dmage/triage/pkg/atomicfile"
 )
 
-// loadFailures loads a builds file and one or more test failure files. It maps build paths to builds
-// and groups test failures by test name. memoize determines if memoized results should attempt to be
-// retrieved, and if new results should be memoized to JSON.
-func loadFailures(buildsFilepath string, testsFilepaths []string, memoize bool) (map[string]build, map[string][]failure, error) {
-	builds, err := loadBuilds(buildsFilepath, memoize)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Could not retrieve builds: %s", err)
+// LoadInput loads a builds file and one or more test failure files in the format of
+// triage_builds.json and triage_tests.json. buildsFilepath can be empty if only failures are needed.
+func LoadInput(buildsFilepath string, testsFilepaths []string) (*Input, error) {
+	in := NewInput()
+
+	if buildsFilepath != "" {
+		err := loadBuilds(in, buildsFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not retrieve builds: %s", err)
+		}
 	}
 
-	tests, err := loadTests(testsFilepaths, memoize)
+	err := loadTests(in, testsFilepaths)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not retrieve tests: %s", err)
+		return nil, fmt.Errorf("Could not retrieve tests: %s", err)
 	}
 
-	return builds, tests, nil
+	return in, nil
 }
 
 // loadPrevious loads a previous output and returns the 'clustered' field.
@@ -76,6 +77,11 @@ func loadOwners(filepath string) (map[string][]string, error) {
 	return owners, nil
 }
 
+// WriteOwners writes owners in the format of the test owner SIGs file.
+func WriteOwners(filepath string, owners map[string][]string) error {
+	return writeJSON(filepath, owners)
+}
+
 // writeResults outputs the results of clustering to a file.
 func writeResults(filepath string, data jsonOutput) error {
 	err := writeJSON(filepath, data)
@@ -104,52 +110,9 @@ func writeRenderedSlice(filepath string, clustered []jsonCluster, builds columns
 	return nil
 }
 
-/*
-getMemoizedResults attempts to retrieve memoized function results from the given filepath. If it
-succeeds, it places the results into v and returns true. Otherwise, it returns false. Internally,
-it calls encoding/json's Unmarshal using v as the second argument. Therefore, v mut be a non-nil
-pointer.
-
-message is a message that gets printed on success, appended to "Done (cached) ". If it is the empty
-string, no message is printed.
-*/
-func getMemoizedResults(filepath string, message string, v interface{}) (ok bool) {
-	err := getJSON(filepath, v)
-	if err == nil {
-		if message != "" {
-			klog.V(2).Infof("Retrieved memoized results from %#v, done (cached) %s", filepath, message)
-		}
-		return true
-	}
-	return false
-}
-
-/*
-memoizeResults saves the results stored in v to a JSON file. v should be a value, not a pointer. It
-prints a warning if the results could not be memoized.
-
-message is a message that gets printed on success, appended to "Done ". If it is the empty
-string, no message is printed.
-*/
-func memoizeResults(filepath, message string, v interface{}) {
-	klog.V(2).Infof("Memoizing results to %s...", filepath)
-
-	err := writeJSON(filepath, v)
-	if err != nil {
-		klog.Warningf("Could not memoize results to '%s': %s", filepath, err)
-		return
-	}
-
-	if message != "" {
-		klog.V(2).Infof("Successfully memoized, done " + message)
-	}
-}
-
-// jsonBuild represents a build as reported by the JSON. All values are strings.
-// This should not be instantiated directly, but rather via the encoding/json package's
-// Unmarshal method. This is an intermediary state for the data until it can be put into
-// a build object.
-type jsonBuild struct {
+// JSONBuild represents a build as reported by the JSON. All values are strings.
+// This is an intermediary state for the data until it can be put into a build object.
+type JSONBuild struct {
 	Path        string `json:"path"`
 	Started     string `json:"started"`
 	Elapsed     string `json:"elapsed"`
@@ -163,9 +126,9 @@ type jsonBuild struct {
 	Key         string `json:"key"` // Often nonexistent
 }
 
-// asBuild is a factory function that creates a build object from a jsonBuild object, appropriately
+// asBuild is a factory function that creates a build object from a JSONBuild object, appropriately
 // handling all type conversions.
-func (jb *jsonBuild) asBuild() (build, error) {
+func (jb *JSONBuild) asBuild() (build, error) {
 	// The build object that will be returned, initialized with the values that
 	// don't need conversion.
 	b := build{
@@ -224,70 +187,38 @@ func (jb *jsonBuild) asBuild() (build, error) {
 	return b, nil
 }
 
-// loadBuilds parses a JSON file containing build information and returns a map from build paths
-// to build objects. memoize determines if memoized results should attempt to be retrieved, and if
-// new results should be memoized to JSON.
-func loadBuilds(filepath string, memoize bool) (map[string]build, error) {
-	const memoPath string = "memo_load_builds.json"
-	const memoMessage string = "loading builds"
-
-	builds := make(map[string]build)
-
-	// Try to retrieve memoized results first to avoid another computation
-	if memoize && getMemoizedResults(memoPath, memoMessage, &builds) {
-		return builds, nil
-	}
-
+// loadBuilds parses a JSON file containing build information and adds the builds to in.
+func loadBuilds(in *Input, filepath string) error {
 	// jsonBuilds temporarily stores the builds as they are retrieved from the JSON file
 	// until they can be converted to build objects
-	jsonBuilds := make([]jsonBuild, 0)
+	jsonBuilds := make([]JSONBuild, 0)
 
 	err := getJSON(filepath, &jsonBuilds)
 	if err != nil {
-		return nil, fmt.Errorf("Could not get builds JSON: %s", err)
+		return fmt.Errorf("Could not get builds JSON: %s", err)
 	}
 
-	// Convert the build information to internal build objects and store them in the builds map
 	for _, jBuild := range jsonBuilds {
-		// Skip builds without a start time or build number
-		if jBuild.Started == "" || jBuild.Number == "" {
-			continue
-		}
-
-		bld, err := jBuild.asBuild()
-		if err != nil {
-			return nil, fmt.Errorf("Could not create build object from jsonBuild object: %s", err)
+		if err := in.AddBuild(jBuild); err != nil {
+			return err
 		}
-
-		if strings.Contains(bld.Path, "pr-logs") {
-			parts := strings.Split(bld.Path, "/")
-			bld.PR = parts[len(parts)-3]
-		}
-
-		builds[bld.Path] = bld
-	}
-
-	if memoize {
-		memoizeResults(memoPath, memoMessage, builds)
 	}
 
-	return builds, nil
+	return nil
 }
 
-// jsonFailure represents a test failure as reported by the JSON. All values are strings.
-// This should not be instantiated directly, but rather via the encoding/json package's
-// Unmarshal method. This is an intermediary state for the data until it can be put into
-// a failure object.
-type jsonFailure struct {
+// JSONFailure represents a test failure as reported by the JSON. All values are strings.
+// This is an intermediary state for the data until it can be put into a failure object.
+type JSONFailure struct {
 	Started     string `json:"started"`
 	Build       string `json:"build"`
 	Name        string `json:"name"`
 	FailureText string `json:"failure_text"`
 }
 
-// asFailure is a factory function that creates a failure object from the jsonFailure object,
+// asFailure is a factory function that creates a failure object from the JSONFailure object,
 // appropriately handling all type conversions.
-func (jf *jsonFailure) asFailure() (failure, error) {
+func (jf *JSONFailure) asFailure() (failure, error) {
 	// The failure object that will be returned, initialized with the values that
 	// don't need conversion.
 	f := failure{
@@ -310,69 +241,37 @@ func (jf *jsonFailure) asFailure() (failure, error) {
 	return f, nil
 }
 
-// loadTests parses multiple JSON files containing test information for failed tests. It returns a
-// map from test names to failure objects. memoize determines if memoized results should attempt to
-// be retrieved, and if new results should be memoized to JSON.
-func loadTests(testsFilepaths []string, memoize bool) (map[string][]failure, error) {
-	const memoPath string = "memo_load_tests.json"
-	const memoMessage string = "loading tests"
-
-	tests := make(map[string][]failure)
-
-	// Try to retrieve memoized results first to avoid another computation
-	if memoize && getMemoizedResults(memoPath, memoMessage, &tests) {
-		return tests, nil
-	}
-
-	// jsonTests temporarily stores the tests as they are retrieved from the JSON file
-	// until they can be converted to failure objects
-	jsonFailures := make([]jsonFailure, 0)
+// loadTests parses multiple JSON files containing test information for failed tests and adds
+// the failures to in.
+func loadTests(in *Input, testsFilepaths []string) error {
 	for _, filepath := range testsFilepaths {
-		file, err := os.Open(filepath)
-		if err != nil {
-			return nil, fmt.Errorf("Could not open tests file '%s': %s", filepath, err)
-		}
-		defer file.Close()
-
-		// Read each line in the file as its own JSON object
-		decoder := json.NewDecoder(file)
-		for {
-			// TODO: this probably gives fairly useless errors
-			var jf jsonFailure
-			if err := decoder.Decode(&jf); err == io.EOF {
-				break // reached EOF
-			} else if err != nil {
-				return nil, err
-			}
-			jsonFailures = append(jsonFailures, jf)
-		}
-
-		// Convert the failure information to internal failure objects and store them in tests
-		for _, jf := range jsonFailures {
-			// Check if tests of this type are already in the map
-			if _, ok := tests[jf.Name]; !ok {
-				tests[jf.Name] = make([]failure, 0)
-			}
-
-			test, err := jf.asFailure()
+		err := func() error {
+			file, err := os.Open(filepath)
 			if err != nil {
-				return nil, fmt.Errorf("Could not create failure object from jsonFailure object: %s", err)
+				return fmt.Errorf("Could not open tests file '%s': %s", filepath, err)
 			}
-
-			tests[jf.Name] = append(tests[jf.Name], test)
+			defer file.Close()
+
+			// Read each line in the file as its own JSON object
+			decoder := json.NewDecoder(file)
+			for {
+				var jf JSONFailure
+				if err := decoder.Decode(&jf); err == io.EOF {
+					return nil // reached EOF
+				} else if err != nil {
+					return fmt.Errorf("Could not decode tests file '%s': %s", filepath, err)
+				}
+				if err := in.AddFailure(jf); err != nil {
+					return err
+				}
+			}
+		}()
+		if err != nil {
+			return err
 		}
 	}
 
-	// Sort the failures within each test by build
-	for _, testSlice := range tests {
-		sort.Slice(testSlice, func(i, j int) bool { return testSlice[i].Build < testSlice[j].Build })
-	}
-
-	if memoize {
-		memoizeResults(memoPath, memoMessage, tests)
-	}
-
-	return tests, nil
+	return nil
 }
 
 // getJSON opens a JSON file, parses it according to the schema provided by v, and places the results
@@ -393,14 +292,20 @@ func getJSON(filepath string, v interface{}) error {
 	return nil
 }
 
-// writeJSON generates JSON according to v and writes the results to filepath.
+// writeJSON generates JSON according to v and atomically writes the results to filepath.
 func writeJSON(filepath string, v interface{}) error {
-	output, err := json.Marshal(v)
+	f, err := atomicfile.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("Could not write JSON to file: %s", err)
+	}
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(v)
 	if err != nil {
-		return fmt.Errorf("Could not encode JSON: %s\nTried to encode the following: %#v", err, v)
+		return fmt.Errorf("Could not encode JSON: %s", err)
 	}
 
-	err = ioutil.WriteFile(filepath, output, 0644)
+	err = f.Commit()
 	if err != nil {
 		return fmt.Errorf("Could not write JSON to file: %s", err)
 	}
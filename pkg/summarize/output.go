@@ -65,11 +65,16 @@ func render(builds map[string]build, clustered nestedFailuresGroups) jsonOutput
 // sigLabelRE matches '[sig-x]', so long as x does not contain a closing bracket.
 var sigLabelRE = regexp.MustCompile(`\[sig-([^]]*)\]`)
 
+// exactNameSuffix marks entries of the owners file that match whole test names rather than
+// prefixes.
+const exactNameSuffix = "$"
+
 /*
 annotateOwners assigns ownership to a cluster based on the share of hits in the last day. It modifies
 the data parameter in place.
 
-owners maps SIG names to collections of SIG-specific prefixes.
+owners maps SIG names to collections of SIG-specific prefixes. Prefixes that end with
+exactNameSuffix match whole names.
 */
 func annotateOwners(data *jsonOutput, builds map[string]build, owners map[string][]string) error {
 	var ownerRE *regexp.Regexp = nil
@@ -87,7 +92,9 @@ func annotateOwners(data *jsonOutput, builds map[string]build, owners map[string
 			// prefixREs is a collection of non-empty prefixes with any special regex characters quoted
 			prefixREs := make([]string, 0, len(prefixes))
 			for _, prefix := range prefixes {
-				if prefix != "" {
+				if strings.HasSuffix(prefix, exactNameSuffix) {
+					prefixREs = append(prefixREs, regexp.QuoteMeta(strings.TrimSuffix(prefix, exactNameSuffix))+"$")
+				} else if prefix != "" {
 					prefixREs = append(prefixREs, regexp.QuoteMeta(prefix))
 				}
 			}
@@ -0,0 +1,77 @@
+package summarize
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/dmage/triage/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+type ownerRule struct {
+	pattern *regexp.Regexp
+	owner   string
+}
+
+// GenerateOwners maps owners to names of the failed tests from in, in the format of the owners
+// file. A test is assigned to the SIG from its [sig-xxx] tag or, if it doesn't have one, to the
+// owner of the first matching override. Tags take precedence as they do when clusters are
+// annotated with owners. Tests without owners are omitted. Names end with exactNameSuffix, so
+// they don't match longer names of other tests.
+func GenerateOwners(in *Input, overrides []config.OwnerOverride) (map[string][]string, error) {
+	rules := make([]ownerRule, 0, len(overrides))
+	for _, o := range overrides {
+		re, err := regexp.Compile(o.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for owner %s: %w", o.Owner, err)
+		}
+		owner, err := config.OwnerName(o.Owner)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", o.Pattern, err)
+		}
+		rules = append(rules, ownerRule{pattern: re, owner: owner})
+	}
+
+	testNames := make([]string, 0, len(in.failures))
+	for testName := range in.failures {
+		testNames = append(testNames, testName)
+	}
+	sort.Strings(testNames)
+
+	owners := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, testName := range testNames {
+		// Owners are looked up by normalized names, the first test wins if several
+		// tests have the same normalized name.
+		normalized := normalizeName(testName)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+
+		var owner string
+		if submatches := sigLabelRE.FindStringSubmatch(testName); submatches != nil {
+			owner = submatches[1]
+			if _, err := config.OwnerName(owner); err != nil {
+				// Clusters get owners of tagged tests from their tags, entries with
+				// invalid owners would only break the owners file.
+				klog.V(2).Infof("Skipping test %q: %s", testName, err)
+				continue
+			}
+		} else {
+			for _, r := range rules {
+				if r.pattern.MatchString(testName) {
+					owner = r.owner
+					break
+				}
+			}
+		}
+		if owner == "" {
+			continue
+		}
+
+		seen[normalized] = true
+		owners[owner] = append(owners[owner], normalized+exactNameSuffix)
+	}
+	return owners, nil
+}
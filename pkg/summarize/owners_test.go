@@ -0,0 +1,112 @@
+package summarize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dmage/triage/pkg/config"
+)
+
+func TestGenerateOwners(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tests     []string
+		overrides []config.OwnerOverride
+		want      map[string][]string
+		wantErr   bool
+	}{
+		{
+			name:  "tags",
+			tests: []string{"[sig-node] Pods should run", "[sig-api-machinery] Watch"},
+			want: map[string][]string{
+				"node":          {"Pods should run$"},
+				"api-machinery": {"Watch$"},
+			},
+		},
+		{
+			name:  "overrides apply to untagged tests",
+			tests: []string{"operator.Run", "[sig-node] kubelet.Run", "install should work"},
+			overrides: []config.OwnerOverride{
+				{Pattern: `^operator\.`, Owner: "sig-cluster-lifecycle"},
+				{Pattern: `operator`, Owner: "other"},
+			},
+			want: map[string][]string{
+				"cluster-lifecycle": {"operator.Run$"},
+				"node":              {"kubelet.Run$"},
+			},
+		},
+		{
+			name:  "invalid tags are skipped",
+			tests: []string{"[sig-foo.bar] test", "[sig-node] test"},
+			want: map[string][]string{
+				"node": {"test$"},
+			},
+		},
+		{
+			name:      "invalid owner",
+			tests:     []string{"operator.Run"},
+			overrides: []config.OwnerOverride{{Pattern: `^operator\.`, Owner: "cluster lifecycle"}},
+			wantErr:   true,
+		},
+		{
+			name:      "empty owner",
+			tests:     []string{"operator.Run"},
+			overrides: []config.OwnerOverride{{Pattern: `^operator\.`, Owner: "sig-"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid pattern",
+			tests:     []string{"operator.Run"},
+			overrides: []config.OwnerOverride{{Pattern: `(`, Owner: "cluster-lifecycle"}},
+			wantErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := NewInput()
+			for _, name := range tc.tests {
+				if err := in.AddFailure(JSONFailure{Started: "1", Build: "logs/job/1", Name: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := GenerateOwners(in, tc.overrides)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOwnerREMatchesExactNames(t *testing.T) {
+	jobs := []job{{Name: "job", BuildNumbers: []string{"1"}}}
+	data := jsonOutput{
+		Clustered: []jsonCluster{
+			{Tests: []test{{Name: "operator.Run", Jobs: jobs}}},
+			{Tests: []test{{Name: "operator.Run with retries", Jobs: jobs}}},
+		},
+		Builds: columns{JobPaths: map[string]string{"job": "/logs/job"}},
+	}
+	builds := map[string]build{"/logs/job/1": {Started: 1}}
+	owners := map[string][]string{
+		"cluster-lifecycle": {"operator.Run$"},
+	}
+	if err := annotateOwners(&data, builds, owners); err != nil {
+		t.Fatal(err)
+	}
+	if got := data.Clustered[0].Owner; got != "cluster-lifecycle" {
+		t.Errorf("owner of operator.Run: got %q, want cluster-lifecycle", got)
+	}
+	if got := data.Clustered[1].Owner; got != "testing" {
+		t.Errorf("owner of operator.Run with retries: got %q, want testing", got)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package summarize groups test failures together by finding edit distances between their failure messages,
+// and emits JSON for rendering in a browser.
+package summarize
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const longOutputLen = 10000
+const truncatedSep = "\n...[truncated]...\n"
+const maxClusterTextLen = longOutputLen + len(truncatedSep)
+
+// DefaultNumWorkers is the number of worker goroutines that has shown to be a sensible default.
+var DefaultNumWorkers = 2*runtime.NumCPU() - 1
+
+// Input holds builds and test failures to be clustered.
+type Input struct {
+	builds   map[string]build
+	failures map[string][]failure
+}
+
+// NewInput returns an empty input.
+func NewInput() *Input {
+	return &Input{
+		builds:   make(map[string]build),
+		failures: make(map[string][]failure),
+	}
+}
+
+// AddBuild adds a build to the input. Builds without a start time or a build number are skipped.
+func (in *Input) AddBuild(jb JSONBuild) error {
+	if jb.Started == "" || jb.Number == "" {
+		return nil
+	}
+
+	bld, err := jb.asBuild()
+	if err != nil {
+		return fmt.Errorf("Could not create build object from JSONBuild object: %s", err)
+	}
+
+	if strings.Contains(bld.Path, "pr-logs") {
+		parts := strings.Split(bld.Path, "/")
+		bld.PR = parts[len(parts)-3]
+	}
+
+	in.builds[bld.Path] = bld
+	return nil
+}
+
+// AddFailure adds a test failure to the input.
+func (in *Input) AddFailure(jf JSONFailure) error {
+	f, err := jf.asFailure()
+	if err != nil {
+		return fmt.Errorf("Could not create failure object from JSONFailure object: %s", err)
+	}
+
+	in.failures[jf.Name] = append(in.failures[jf.Name], f)
+	return nil
+}
+
+// Options configures clustering of test failures.
+type Options struct {
+	// Previous is the path to the previous output. Clusters from it are reused when possible.
+	Previous string
+
+	// Owners is the path to the test owner SIGs file. It is ignored if OwnersMap is set.
+	Owners string
+
+	// OwnersMap maps SIG names to prefixes of test names, like the test owner SIGs file.
+	OwnersMap map[string][]string
+
+	// Output is the path to the output file.
+	Output string
+
+	// OutputSlices is the template for paths to slices. It must include PREFIX.
+	OutputSlices string
+
+	// NumWorkers is the number of worker goroutines to spawn for parallelized functions.
+	NumWorkers int
+
+	// Assignments, if set, stores the clusters that failures have been put into. The assignments
+	// are saved after every run.
+	Assignments AssignmentStore
+
+	// Incremental keeps failures that have assignments in their clusters and clusters only new
+	// failures. All failures from the input are still rendered. It requires Assignments.
+	Incremental bool
+}
+
+// Validate checks the options.
+func (opts *Options) Validate() error {
+	if opts.Output == "" {
+		return fmt.Errorf("output path is required")
+	}
+	if opts.OutputSlices != "" && !strings.Contains(opts.OutputSlices, "PREFIX") {
+		return fmt.Errorf("'PREFIX' not in output slices template %q", opts.OutputSlices)
+	}
+	if opts.Incremental && opts.Assignments == nil {
+		return fmt.Errorf("incremental clustering requires an assignment store")
+	}
+	return nil
+}
+
+// Run clusters the failures from in and writes the results.
+func (opts *Options) Run(ctx context.Context, in *Input) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	numWorkers := opts.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = DefaultNumWorkers
+	}
+
+	klog.V(1).Infof("Running with %d workers (%d detected CPUs)", numWorkers, runtime.NumCPU())
+
+	builds := in.builds
+	failedTests := in.failures
+
+	// Sort the failures within each test by build
+	for _, testSlice := range failedTests {
+		sort.Slice(testSlice, func(i, j int) bool { return testSlice[i].Build < testSlice[j].Build })
+	}
+
+	var previousClustered []jsonCluster
+	if opts.Previous != "" {
+		klog.V(2).Infof("Loading previous")
+		var err error
+		previousClustered, err = loadPrevious(opts.Previous)
+		if err != nil {
+			klog.Warningf("Could not get previous results, they will not be used: %s", err)
+		}
+	}
+
+	var assigned nestedFailuresGroups
+	if opts.Incremental {
+		assignments, err := opts.Assignments.LoadClusterAssignments()
+		if err != nil {
+			return fmt.Errorf("Could not load cluster assignments: %s", err)
+		}
+		assigned, failedTests = splitAssigned(failedTests, assignments)
+	}
+
+	clusteredLocal := clusterLocal(failedTests, numWorkers)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	clustered := clusterGlobal(clusteredLocal, previousClustered, assigned)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.Assignments != nil {
+		err := opts.Assignments.SaveClusterAssignments(collectAssignments(clustered))
+		if err != nil {
+			return fmt.Errorf("Could not save cluster assignments: %s", err)
+		}
+	}
+
+	klog.V(2).Infof("Rendering results...")
+	start := time.Now()
+
+	data := render(builds, clustered)
+
+	// Load the owners from the file, if given
+	owners := opts.OwnersMap
+	if owners == nil && opts.Owners != "" {
+		var err error
+		owners, err = loadOwners(opts.Owners)
+		if err != nil {
+			klog.Warningf("Could not load owners file, clusters will only be labeled based on test names: %s", err)
+		}
+	}
+	err := annotateOwners(&data, builds, owners)
+	if err != nil {
+		klog.Warningf("Could not annotate owners: %s", err)
+	}
+
+	if opts.OutputSlices != "" {
+		for subset := 0; subset < 256; subset++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			idPrefix := fmt.Sprintf("%02x", subset)
+			subsetClusters, cols := renderSlice(data, builds, idPrefix, "")
+			err = writeRenderedSlice(strings.Replace(opts.OutputSlices, "PREFIX", idPrefix, -1), subsetClusters, cols)
+			if err != nil {
+				return fmt.Errorf("Could not write subset %d to file: %s", subset, err)
+			}
+		}
+
+		// If owners is nil, initialize it
+		if owners == nil {
+			owners = make(map[string][]string)
+		}
+		if _, ok := owners["testing"]; !ok {
+			owners["testing"] = make([]string, 0)
+		}
+		for owner := range owners {
+			ownerResults, cols := renderSlice(data, builds, "", owner)
+			err = writeRenderedSlice(strings.Replace(opts.OutputSlices, "PREFIX", "sig-"+owner, -1), ownerResults, cols)
+			if err != nil {
+				return fmt.Errorf("Could not write result for owner '%s' to file: %s", owner, err)
+			}
+		}
+	}
+
+	// The main output is written last, so that its presence means that the slices are up to date.
+	err = writeResults(opts.Output, data)
+	if err != nil {
+		return fmt.Errorf("Could not write results to file: %s", err)
+	}
+
+	klog.V(0).Infof("Finished rendering results in %s", time.Since(start).String())
+	return nil
+}
@@ -1,20 +1,76 @@
 package testname
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
-)
 
-var (
-	suiteRe   = regexp.MustCompile(`\[Suite:[^]]*\]`)
-	skippedRe = regexp.MustCompile(`\[Skipped:[^]]*\]`)
-	spacesRe  = regexp.MustCompile(`[ \t]+`)
+	"github.com/dmage/triage/pkg/config"
 )
 
-func Normalize(x string) string {
-	x = suiteRe.ReplaceAllString(x, "")
-	x = skippedRe.ReplaceAllString(x, "")
+// DefaultRules strip [Suite:...] and [Skipped:...] tags from test names.
+var DefaultRules = []config.NormalizationRule{
+	{Pattern: `\[Suite:[^]]*\]`},
+	{Pattern: `\[Skipped:[^]]*\]`},
+}
+
+var spacesRe = regexp.MustCompile(`[ \t]+`)
+
+type rule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Normalizer rewrites test names using an ordered list of rules. After the
+// rules are applied, runs of spaces are collapsed and the name is trimmed.
+type Normalizer struct {
+	rules []rule
+}
+
+func NewNormalizer(rules []config.NormalizationRule) (*Normalizer, error) {
+	n := &Normalizer{}
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in rule %d: %w", i+1, err)
+		}
+		n.rules = append(n.rules, rule{
+			re:          re,
+			replacement: r.Replacement,
+		})
+	}
+	return n, nil
+}
+
+// NewNormalizerFromFile returns a normalizer with the rules from the config
+// file path, or with DefaultRules if path is empty.
+func NewNormalizerFromFile(path string) (*Normalizer, error) {
+	if path == "" {
+		return NewNormalizer(DefaultRules)
+	}
+	cfg, err := config.LoadNormalizationConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load normalization rules from %s: %w", path, err)
+	}
+	n, err := NewNormalizer(cfg.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+func (n *Normalizer) Normalize(x string) string {
+	for _, r := range n.rules {
+		x = r.re.ReplaceAllString(x, r.replacement)
+	}
 	x = spacesRe.ReplaceAllString(x, " ")
 	x = strings.TrimSpace(x)
 	return x
 }
+
+var defaultNormalizer, _ = NewNormalizer(DefaultRules)
+
+// Normalize normalizes x using DefaultRules.
+func Normalize(x string) string {
+	return defaultNormalizer.Normalize(x)
+}
@@ -1,14 +1,70 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SchemeGCS is the scheme of builds that are stored in Google Cloud Storage.
+	SchemeGCS = "gs"
+
+	// SchemeFile is the scheme of builds that are stored in a local directory.
+	SchemeFile = "file"
+
+	// SchemeS3 is the scheme of builds that are stored in an S3-compatible
+	// object storage.
+	SchemeS3 = "s3"
+
+	// SchemeGCSWeb is the scheme of builds that are available through gcsweb
+	// or another HTTP server with directory listings.
+	SchemeGCSWeb = "gcsweb"
+)
 
 type Build struct {
 	Job       string
 	BuildID   string
+	Scheme    string
 	GCSBucket string
 	GCSPrefix string
+
+	// Org, Repo and PullNumber identify the pull request that was tested by
+	// a presubmit build. BaseSHA and PullSHA are the tested commits.
+	Org        string
+	Repo       string
+	PullNumber int
+	BaseSHA    string
+	PullSHA    string
+
+	Metadata BuildMetadata
+}
+
+// IsLink reports whether GCSPrefix points to a file with the location of the
+// build rather than to the build directory. Prow creates such files for
+// presubmits in pr-logs/directory/<job>/<build-id>.txt.
+func (b Build) IsLink() bool {
+	return strings.HasSuffix(b.GCSPrefix, ".txt")
+}
+
+// IsPull reports whether the build tested a pull request.
+func (b Build) IsPull() bool {
+	return b.PullNumber != 0
+}
+
+// ObjectURL returns the URL of an object from the build's bucket.
+func (b Build) ObjectURL(object string) string {
+	scheme := b.Scheme
+	if scheme == "" {
+		scheme = SchemeGCS
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, b.GCSBucket, object)
+}
+
+// URL returns the URL of the build directory.
+func (b Build) URL() string {
+	return b.ObjectURL(b.GCSPrefix)
 }
 
 func (b Build) String() string {
-	return fmt.Sprintf("%s @ %s (gs://%s/%s)", b.Job, b.BuildID, b.GCSBucket, b.GCSPrefix)
+	return fmt.Sprintf("%s @ %s (%s)", b.Job, b.BuildID, b.URL())
 }
@@ -0,0 +1,9 @@
+package types
+
+// ClusterAssignment records the cluster that a test failure has been put into.
+type ClusterAssignment struct {
+	Build   string // path of the build as exported for triage
+	Test    string
+	Failure string // hash of the failure text
+	Cluster string // text of the cluster
+}
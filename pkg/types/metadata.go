@@ -0,0 +1,41 @@
+package types
+
+// Pull is a pull request that was tested by a build.
+type Pull struct {
+	Number int    `json:"number"`
+	Author string `json:"author,omitempty"`
+	SHA    string `json:"sha,omitempty"`
+	Title  string `json:"title,omitempty"`
+}
+
+// Refs describes the commits of a repository that were tested by a build.
+type Refs struct {
+	Org     string `json:"org"`
+	Repo    string `json:"repo"`
+	BaseRef string `json:"base_ref,omitempty"`
+	BaseSHA string `json:"base_sha,omitempty"`
+	Pulls   []Pull `json:"pulls,omitempty"`
+}
+
+// BuildMetadata is the information about a build that is collected from
+// started.json and prowjob.json.
+type BuildMetadata struct {
+	// Type is the type of the Prow job (presubmit, postsubmit, periodic or
+	// batch).
+	Type string `json:"type,omitempty"`
+
+	// Refs are the tested repositories, the primary one goes first.
+	Refs []Refs `json:"refs,omitempty"`
+
+	RepoVersion string                 `json:"repo_version,omitempty"`
+	RepoCommit  string                 `json:"repo_commit,omitempty"`
+	Node        string                 `json:"node,omitempty"`
+	ProwJobURL  string                 `json:"prowjob_url,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// IsZero reports whether m does not have any information.
+func (m *BuildMetadata) IsZero() bool {
+	return m.Type == "" && len(m.Refs) == 0 && m.RepoVersion == "" && m.RepoCommit == "" &&
+		m.Node == "" && m.ProwJobURL == "" && len(m.Metadata) == 0
+}
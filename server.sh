@@ -13,4 +13,4 @@ while true; do
     sleep 5
 done
 
-exec scraper serve --failure_data=./output/
+exec scraper serve --failure_data=./output/ ${HISTORY_URL:+"--history_url=${HISTORY_URL}"}
@@ -1,10 +0,0 @@
-// +build tools
-
-// Official workaround to track tool dependencies with go modules:
-// https://github.com/golang/go/wiki/Modules#how-can-i-track-tool-dependencies-for-a-module
-
-package tools
-
-import (
-	"k8s.io/test-infra/triage"
-)